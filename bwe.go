@@ -0,0 +1,107 @@
+package ghost
+
+import (
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v3"
+)
+
+// TargetBitrateHandler called when the estimated available send bitrate
+// changes. Bitrate in bits per second.
+type TargetBitrateHandler func(bps int)
+
+// CongestionControlConfig configures the send-side bandwidth estimation.
+// Zero values keep the defaults of the estimator.
+type CongestionControlConfig struct {
+	InitialBitrate int
+	MinBitrate     int
+	MaxBitrate     int
+}
+
+// WithCongestionControl activates transport-wide-cc feedback and the google
+// congestion control estimator. Without this option only REMB messages of
+// the remote peer are used for the estimation.
+func WithCongestionControl(config CongestionControlConfig) ClientOption {
+	return func(h *Client) {
+		h.congestionControl = &config
+	}
+}
+
+// SetTargetBitrateHandler forwards changes of the estimated available send
+// bitrate. Ingest sources can adapt their encoding or drop frames.
+func (cl *Client) SetTargetBitrateHandler(handler TargetBitrateHandler) {
+	cl.bweMu.Lock()
+	defer cl.bweMu.Unlock()
+	cl.targetBitrateHandler = handler
+}
+
+// configureCongestionControl registers transport-cc feedback and the gcc
+// interceptor. Must be called after the codecs are registered.
+func (cl *Client) configureCongestionControl(m *webrtc.MediaEngine,
+	interceptReg *interceptor.Registry) error {
+	if cl.congestionControl == nil {
+		return nil
+	}
+	config := *cl.congestionControl
+
+	ccFactory, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		// don't delay packets, just estimate
+		opts := []gcc.Option{gcc.SendSideBWEPacer(gcc.NewNoOpPacer())}
+		if config.InitialBitrate > 0 {
+			opts = append(opts, gcc.SendSideBWEInitialBitrate(config.InitialBitrate))
+		}
+		if config.MinBitrate > 0 {
+			opts = append(opts, gcc.SendSideBWEMinBitrate(config.MinBitrate))
+		}
+		if config.MaxBitrate > 0 {
+			opts = append(opts, gcc.SendSideBWEMaxBitrate(config.MaxBitrate))
+		}
+		return gcc.NewSendSideBWE(opts...)
+	})
+	if err != nil {
+		return err
+	}
+	ccFactory.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		estimator.OnTargetBitrateChange(func(bps int) {
+			cl.updateTargetBitrate(bps, -1)
+		})
+	})
+	interceptReg.Add(ccFactory)
+
+	m.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBTransportCC}, webrtc.RTPCodecTypeVideo)
+	m.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBTransportCC}, webrtc.RTPCodecTypeAudio)
+	return webrtc.ConfigureTWCCHeaderExtensionSender(m, interceptReg)
+}
+
+// updateTargetBitrate stores the latest gcc and remb estimates. Negative
+// values keep the previous estimate. The lower one of both is reported.
+func (cl *Client) updateTargetBitrate(gccBitrate, rembBitrate int) {
+	cl.bweMu.Lock()
+	if gccBitrate >= 0 {
+		cl.gccBitrate = gccBitrate
+	}
+	if rembBitrate >= 0 {
+		cl.rembBitrate = rembBitrate
+	}
+	target := cl.gccBitrate
+	if target == 0 || (cl.rembBitrate > 0 && cl.rembBitrate < target) {
+		target = cl.rembBitrate
+	}
+	changed := target != cl.targetBitrate
+	cl.targetBitrate = target
+	handler := cl.targetBitrateHandler
+	cl.bweMu.Unlock()
+
+	if changed && target > 0 && handler != nil {
+		handler(target)
+	}
+}
+
+// TargetBitrate returns the current estimated send bitrate in bits per
+// second or 0 if no estimate is available yet.
+func (cl *Client) TargetBitrate() int {
+	cl.bweMu.Lock()
+	defer cl.bweMu.Unlock()
+	return cl.targetBitrate
+}
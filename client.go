@@ -2,13 +2,15 @@ package ghost
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/eyeson-team/gosepp/v3"
+	"github.com/pion/ice/v2"
 	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v3"
@@ -51,6 +53,8 @@ type RTPWriter interface {
 }
 
 // ConnectedHandler called when connection succeeded. Providing tracks to write to.
+// Tracks of media kinds which are not sent are nil. The video track implements
+// CodecWriter to report the negotiated codec.
 type ConnectedHandler func(connected bool, localVideoTrack RTPWriter, localAudioTrack RTPWriter)
 
 // MediaReceivedHandler called when a new rtp-Packet is available.
@@ -65,13 +69,35 @@ type DataChannelReceivedHandler func(data []byte)
 // EyesonClient call interface
 type EyesonClient interface {
 	Call() error
+	CallContext(ctx context.Context) error
 	TerminateCall() error
+	TerminateCallContext(ctx context.Context) error
 	Destroy()
 	SetConnectedHandler(ConnectedHandler)
+	SetConnectionStateHandler(ConnectionStateHandler)
 	SetTerminatedHandler(TerminatedHandler)
 	SetDataChannelHandler(DataChannelReceivedHandler)
+	SetConferenceEventHandler(ConferenceEventHandler)
+	SendDataChannelMessage(data []byte) error
+	SendMessage(msg ConferenceMessage) error
+	GetStats() CallStats
+	SetStatsHandler(handler StatsHandler, interval time.Duration)
+	SetTargetBitrateHandler(TargetBitrateHandler)
+	SetKeyframeRequestHandler(KeyframeRequestHandler)
 	SetAudioReceivedHandler(MediaReceivedHandler)
 	SetVideoReceivedHandler(MediaReceivedHandler)
+	SetAudioFrameHandler(FrameHandler)
+	SetVideoFrameHandler(FrameHandler)
+	SetRemoteTrackHandler(RemoteTrackHandler)
+	NegotiatedVideoCodec() string
+	VideoSampleWriter() SampleWriter
+	AudioSampleWriter() SampleWriter
+	AddVideoTrack(id string) (*LocalTrack, error)
+	AddAudioTrack(id string) (*LocalTrack, error)
+	RemoveTrack(track RTPWriter) error
+	SetVideoMuted(muted bool) error
+	SetAudioMuted(muted bool) error
+	Events() <-chan Event
 }
 
 // ClientConfigInterface extends the gosepp CallInfoInterface with methods to
@@ -92,23 +118,90 @@ type Client struct {
 	clientID                   string
 	confID                     string
 	peerConnection             *webrtc.PeerConnection
-	call                       *gosepp.Call
+	api                        *webrtc.API
+	dataChannel                *webrtc.DataChannel
+	call                       signalingCall
+	newSignalingCall           func() (signalingCall, error)
 	callID                     string
 	sfuCapable                 bool
 	sendPong                   bool
 	sendOnly                   bool
+	receiveOnly                bool
+	noVideo                    bool
+	noAudio                    bool
 	useH264Codec               bool
 	useAV1Codec                bool
 	useConfProtocol            bool
 	sendMessagesViaSEPP        bool
 	connectedHandler           ConnectedHandler
+	connectionStateHandler     ConnectionStateHandler
 	terminatedHandler          TerminatedHandler
 	dataChannelReceivedHandler DataChannelReceivedHandler
+	conferenceEventHandler     ConferenceEventHandler
 	videoReceivedHandler       MediaReceivedHandler
 	audioReceivedHandler       MediaReceivedHandler
+	videoFrameHandler          FrameHandler
+	audioFrameHandler          FrameHandler
+	remoteTrackHandler         RemoteTrackHandler
+	jitterBufferLatency        time.Duration
 	logger                     gosepp.Logger
 	goseppOptions              []gosepp.CallOption
 	videoCodec                 string
+	videoCodecs                []string
+	codecFmtp                  map[string]string
+	videoTrack                 *localTrack
+	audioTrack                 *localTrack
+	reconnectPolicy            *ReconnectPolicy
+	reconnectMu                sync.Mutex
+	callStarted                bool
+	recovering                 bool
+	terminating                bool
+	connectedNotified          bool
+	iceConnectedCh             chan struct{}
+	statsMu                    sync.Mutex
+	statsGetter                stats.Getter
+	statsStopCh                chan struct{}
+	bitrateSamples             bitrateSamples
+	congestionControl          *CongestionControlConfig
+	bweMu                      sync.Mutex
+	targetBitrateHandler       TargetBitrateHandler
+	targetBitrate              int
+	gccBitrate                 int
+	rembBitrate                int
+	retransmission             RetransmissionConfig
+	retransmissions            *retransmissionCounter
+	keyframeRequestHandler     KeyframeRequestHandler
+	useKeyframeCache           bool
+	keyframeCache              *KeyframeCache
+	pacerConfig                *PacerConfig
+	pacer                      *pacer
+	videoSampleWriter          *sampleWriter
+	localSDPMutators           []LocalSDPMutator
+	remoteSDPObservers         []RemoteSDPObserver
+	trickleICE                 bool
+	candidates                 *candidateExchange
+	tracksMu                   sync.Mutex
+	sendersMu                  sync.Mutex
+	negotiationMu              sync.Mutex
+	answerMu                   sync.Mutex
+	answerCh                   chan error
+	localSenders               []*localSender
+	eventsMu                   sync.Mutex
+	events                     *eventQueue
+	statsEventInterval         time.Duration
+	handlerMu                  sync.RWMutex
+	connMu                     sync.RWMutex
+	routinesMu                 sync.Mutex
+	routines                   sync.WaitGroup
+	destroyed                  bool
+	connClosed                 bool
+	destroyOnce                sync.Once
+	transport                  transportConfig
+	interceptorConfigurers     []InterceptorConfigurer
+	udpMux                     ice.UDPMux
+	tcpMux                     ice.TCPMux
+	audioSampleWriter          *sampleWriter
+	closeCh                    chan struct{}
 }
 
 // ClientOption following options pattern to specify options
@@ -123,6 +216,31 @@ func WithSendOnly() ClientOption {
 	}
 }
 
+// WithReceiveOnly signals the only inbound (server->client)
+// traffic is wanted. No local tracks are handed out via the
+// ConnectedHandler.
+func WithReceiveOnly() ClientOption {
+	return func(h *Client) {
+		h.receiveOnly = true
+	}
+}
+
+// WithoutVideo neither sends nor receives video. The local video
+// track passed to the ConnectedHandler is nil.
+func WithoutVideo() ClientOption {
+	return func(h *Client) {
+		h.noVideo = true
+	}
+}
+
+// WithoutAudio neither sends nor receives audio. The local audio
+// track passed to the ConnectedHandler is nil.
+func WithoutAudio() ClientOption {
+	return func(h *Client) {
+		h.noAudio = true
+	}
+}
+
 // WithForceH264Codec forces the h264 codec.
 func WithForceH264Codec() ClientOption {
 	return func(h *Client) {
@@ -196,9 +314,21 @@ func WithInsecureSkipVerify() ClientOption {
 	}
 }
 
-// NewClient creates a new ghost client.
+// NewClient creates a new ghost client. Failures are returned as
+// CallError, see ErrSetupFailed and ErrSignalingFailed.
 func NewClient(callInfo ClientConfigInterface, opts ...ClientOption) (EyesonClient, error) {
+	cl := newClient(callInfo, opts...)
+	if _, _, err := cl.initConnection(); err != nil {
+		// release the transport listeners and stop the pacer
+		cl.Destroy()
+		return nil, err
+	}
+	return cl, nil
+}
 
+// newClient creates a client with the options applied but without peer
+// connection and signaling.
+func newClient(callInfo ClientConfigInterface, opts ...ClientOption) *Client {
 	cl := &Client{
 		callInfo:            callInfo,
 		clientID:            callInfo.GetClientID(),
@@ -211,111 +341,341 @@ func NewClient(callInfo ClientConfigInterface, opts ...ClientOption) (EyesonClie
 		logger:              &StdoutLogger{},
 		goseppOptions:       []gosepp.CallOption{},
 		videoCodec:          webrtc.MimeTypeVP8,
+		iceConnectedCh:      make(chan struct{}, 1),
+		closeCh:             make(chan struct{}),
+		retransmissions:     newRetransmissionCounter(),
+		bitrateSamples:      bitrateSamples{},
 	}
 
 	for _, opt := range opts {
 		opt(cl)
 	}
-
-	if err := cl.initStack(cl.videoCodec); err != nil {
-		return nil, err
-	}
-	if err := cl.initSig(); err != nil {
-		return nil, err
-	}
-	return cl, nil
+	return cl
 }
 
-// Destroy destroyes a client and closes call and peer connection.
+// Destroy destroyes a client and closes call and peer connection. It
+// waits for the internal goroutines to finish, so within handlers other
+// than the TerminatedHandler it has to be called asynchronously. Further
+// calls have no effect.
 func (cl *Client) Destroy() {
-	if cl.call != nil {
-		cl.call.Close()
+	cl.destroyOnce.Do(func() {
+		cl.reconnectMu.Lock()
+		cl.terminating = true
+		cl.reconnectMu.Unlock()
+
+		cl.routinesMu.Lock()
+		cl.destroyed = true
+		cl.routinesMu.Unlock()
+		close(cl.closeCh)
+
+		// a running recovery can't replace call and peer connection anymore
+		cl.connMu.Lock()
+		cl.connClosed = true
+		call := cl.call
+		peerConnection := cl.peerConnection
+		cl.connMu.Unlock()
+
+		if call != nil {
+			call.Close()
+			cl.setConnectionState(ConnectionLayerSignaling, ConnectionStateClosed)
+		}
+		if peerConnection != nil {
+			peerConnection.Close()
+		}
+
+		cl.routines.Wait()
+		cl.closeTransport()
+	})
+}
+
+// enterRoutine registers a goroutine Destroy waits for. Returns false if
+// the client is destroyed. routines.Done has to be called on exit.
+func (cl *Client) enterRoutine() bool {
+	cl.routinesMu.Lock()
+	defer cl.routinesMu.Unlock()
+	if cl.destroyed {
+		return false
 	}
-	if cl.peerConnection != nil {
-		cl.peerConnection.Close()
+	cl.routines.Add(1)
+	return true
+}
+
+// startRoutine runs fn in a goroutine Destroy waits for.
+func (cl *Client) startRoutine(fn func()) {
+	if !cl.enterRoutine() {
+		return
 	}
+	go func() {
+		defer cl.routines.Done()
+		fn()
+	}()
+}
+
+// activePeerConnection returns the peer connection, which is replaced
+// by a call recovery.
+func (cl *Client) activePeerConnection() *webrtc.PeerConnection {
+	cl.connMu.RLock()
+	defer cl.connMu.RUnlock()
+	return cl.peerConnection
+}
+
+// activeCall returns the signaling call, which is replaced by a call
+// recovery.
+func (cl *Client) activeCall() signalingCall {
+	cl.connMu.RLock()
+	defer cl.connMu.RUnlock()
+	return cl.call
+}
+
+func (cl *Client) activeDataChannel() *webrtc.DataChannel {
+	cl.connMu.RLock()
+	defer cl.connMu.RUnlock()
+	return cl.dataChannel
 }
 
 // SetConnectedHandler forwards a listener callback to receive connection
 // status updates.
 func (cl *Client) SetConnectedHandler(handler ConnectedHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
 	cl.connectedHandler = handler
 }
 
 // SetTerminatedHandler forwards a listener callback to receive termination
 // status updates.
 func (cl *Client) SetTerminatedHandler(handler TerminatedHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
 	cl.terminatedHandler = handler
 }
 
+// notifyTerminated emits EventTerminated and calls the TerminatedHandler.
+// The event is queued first, so it is delivered even if the handler calls
+// Destroy. reason is nil if the call was terminated by the client.
+func (cl *Client) notifyTerminated(reason error) {
+	cl.emit(Event{Type: EventTerminated, Err: reason})
+	cl.handlerMu.RLock()
+	handler := cl.terminatedHandler
+	cl.handlerMu.RUnlock()
+	if handler != nil {
+		handler()
+	}
+}
+
 // SetDataChannelHandler forwards data received via data-channel.
 func (cl *Client) SetDataChannelHandler(handler DataChannelReceivedHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
 	cl.dataChannelReceivedHandler = handler
 }
 
 // SetAudioReceivedHandler forwards media rtp packets.
 func (cl *Client) SetAudioReceivedHandler(handler MediaReceivedHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
 	cl.audioReceivedHandler = handler
 }
 
 // SetVideoReceivedHandler forwards media rtp packets.
 func (cl *Client) SetVideoReceivedHandler(handler MediaReceivedHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
 	cl.videoReceivedHandler = handler
 }
 
 // Call initiates a connection.
 func (cl *Client) Call() error {
+	return cl.CallContext(context.Background())
+}
+
+// CallContext initiates a connection. Signaling, ICE gathering and the SDP
+// exchange are aborted as soon as ctx is done. Failures are returned as
+// CallError, which matches ErrCallTimeout if the deadline of ctx is hit.
+func (cl *Client) CallContext(ctx context.Context) error {
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+	return cl.startCall(ctx)
+}
+
+// startCall sends the offer via a new signaling call and applies the
+// answer. Must be called with negotiationMu held, so track changes are
+// negotiated after the call is started.
+func (cl *Client) startCall(ctx context.Context) error {
 	// create our offer
-	offer, err := cl.createOffer()
+	offer, err := cl.createOffer(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	_, sdpAnswer, err := cl.call.Start(context.Background(),
+	call := cl.activeCall()
+	cl.setConnectionState(ConnectionLayerSignaling, ConnectionStateConnecting)
+	sdpAnswer, err := call.Start(ctx,
 		gosepp.Sdp{SdpType: "offer", Sdp: offer}, cl.callInfo.GetDisplayname())
 	if err != nil {
-		return err
+		cl.setConnectionState(ConnectionLayerSignaling, ConnectionStateFailed)
+		return signalingError(ctx, "start call", err)
 	}
+	cl.setConnectionState(ConnectionLayerSignaling, ConnectionStateConnected)
 
-	if err := cl.peerConnection.SetRemoteDescription(
+	cl.observeRemoteSDP("answer", sdpAnswer.Sdp)
+	if err := cl.activePeerConnection().SetRemoteDescription(
 		webrtc.SessionDescription{SDP: sdpAnswer.Sdp, Type: webrtc.SDPTypeAnswer}); err != nil {
 		cl.logger.Warn("Failed to set remote description: %s.", err)
+		err = &CallError{Kind: ErrSDPRejected, Op: "set remote description", Err: err}
+		cl.emitError(err)
+		cl.abortCall(call)
+		return err
+	}
+	if !cl.noVideo && cl.NegotiatedVideoCodec() == "" {
+		err := &CallError{Kind: ErrCodecNotNegotiated, Op: "negotiate video codec"}
+		cl.emitError(err)
+		cl.abortCall(call)
+		return err
+	}
+	if err := cl.startTrickleICE(ctx, sdpAnswer.Sdp); err != nil {
+		cl.emitError(err)
+		cl.abortCall(call)
+		return err
 	}
 
-	return err
+	cl.reconnectMu.Lock()
+	cl.callStarted = true
+	cl.reconnectMu.Unlock()
+
+	return nil
+}
+
+// abortCall terminates a started call whose answer can't be used. Unless
+// a recovery is running, the client is terminating afterwards.
+func (cl *Client) abortCall(call signalingCall) {
+	cl.reconnectMu.Lock()
+	if !cl.recovering {
+		cl.terminating = true
+	}
+	cl.reconnectMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), renegotiationTimeout)
+	defer cancel()
+	if err := call.Terminate(ctx); err != nil {
+		cl.logger.Warn("Failed to terminate call: %s", err)
+	}
 }
 
 // TerminateCall requests to stop a call.
 func (cl *Client) TerminateCall() error {
-	return cl.call.Terminate(context.Background())
+	return cl.TerminateCallContext(context.Background())
 }
 
-func (cl *Client) initSig() error {
+// TerminateCallContext requests to stop a call. The returned CallError
+// matches ErrCallTimeout if the deadline of ctx is hit before the request
+// is done.
+func (cl *Client) TerminateCallContext(ctx context.Context) error {
+	cl.reconnectMu.Lock()
+	cl.terminating = true
+	cl.reconnectMu.Unlock()
 
-	// append the platform version
+	if err := cl.activeCall().Terminate(ctx); err != nil {
+		return signalingError(ctx, "terminate call", err)
+	}
+	return nil
+}
+
+// contextError maps err to ErrCallTimeout if ctx deadline has been exceeded.
+func contextError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrCallTimeout
+	}
+	return err
+}
 
-	cl.goseppOptions = append(cl.goseppOptions, gosepp.WithPlatformVersion(PlatformVersion))
+// initConnection sets up a new peer connection and signaling call and
+// returns the replaced ones, which have to be closed by the caller. On
+// error the active ones are kept.
+func (cl *Client) initConnection() (*webrtc.PeerConnection, signalingCall, error) {
+	// local tracks are not changed until the new peer connection is active
+	cl.sendersMu.Lock()
+	defer cl.sendersMu.Unlock()
 
-	call, err := gosepp.NewCall(cl.callInfo, cl.logger, cl.goseppOptions...)
+	api, err := cl.newAPI()
 	if err != nil {
-		return err
+		return nil, nil, &CallError{Kind: ErrSetupFailed, Op: "create api", Err: err}
+	}
+	peerConnection, dataChannel, err := cl.initStack(api)
+	if err != nil {
+		return nil, nil, &CallError{Kind: ErrSetupFailed, Op: "create peer connection", Err: err}
 	}
+	call, err := cl.initSig()
+	if err != nil {
+		peerConnection.Close()
+		return nil, nil, err
+	}
+
+	candidates := cl.newCandidateExchange(peerConnection, call)
+
+	cl.connMu.Lock()
+	defer cl.connMu.Unlock()
+	if cl.connClosed {
+		call.Close()
+		peerConnection.Close()
+		return nil, nil, ErrClientDestroyed
+	}
+	oldPeerConnection, oldCall := cl.peerConnection, cl.call
+	cl.peerConnection = peerConnection
+	cl.api = api
+	cl.dataChannel = dataChannel
 	cl.call = call
+	cl.candidates = candidates
+	return oldPeerConnection, oldCall, nil
+}
+
+func (cl *Client) initSig() (signalingCall, error) {
+	newCall := cl.newSignalingCall
+	if newCall == nil {
+		newCall = cl.newSEPPCall
+	}
+	call, err := newCall()
+	if err != nil {
+		return nil, &CallError{Kind: ErrSignalingFailed, Op: "create call", Err: err}
+	}
 
 	call.SetSDPUpdateHandler(func(sdp gosepp.Sdp) {
-		onSdpUpdate(call, cl.peerConnection, sdp, cl.logger)
+		if call != cl.activeCall() {
+			return
+		}
+		cl.onSdpUpdate(call, cl.activePeerConnection(), sdp)
 	})
 
 	call.SetTerminatedHandler(func() {
-		if cl.terminatedHandler != nil {
-			cl.terminatedHandler()
+		if call != cl.activeCall() {
+			return
+		}
+		cl.reconnectMu.Lock()
+		recovering := cl.recovering
+		requested := cl.terminating
+		if !recovering {
+			cl.terminating = true
+		}
+		cl.reconnectMu.Unlock()
+		if recovering {
+			// the broken call is replaced by the recovery.
+			cl.logger.Info("Call terminated while recovering")
+			return
 		}
+
+		cl.setConnectionState(ConnectionLayerSignaling, ConnectionStateClosed)
+		var reason error
+		if !requested {
+			reason = ErrTerminatedByServer
+		}
+		cl.notifyTerminated(reason)
 	})
 
-	return nil
+	return call, nil
 }
 
-func (cl *Client) initStack(videoCodecMimeType string) error {
+// newAPI creates the API of a peer connection with the codecs and
+// interceptors configured.
+func (cl *Client) newAPI() (*webrtc.API, error) {
 
 	// Create a MediaEngine object to configure the supported codec
 	m := webrtc.MediaEngine{}
@@ -326,35 +686,50 @@ func (cl *Client) initStack(videoCodecMimeType string) error {
 		webrtc.RTCPFeedback{Type: "goog-remb"},
 	}
 
-	videoCaps := webrtc.RTPCodecCapability{MimeType: videoCodecMimeType, ClockRate: 90000,
-		Channels: 0, SDPFmtpLine: "", RTCPFeedback: vCodecFBs}
-
-	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
-		RTPCodecCapability: videoCaps,
-		PayloadType:        96,
-	}, webrtc.RTPCodecTypeVideo); err != nil {
-		return err
+	if err := cl.registerVideoCodecs(&m, vCodecFBs); err != nil {
+		return nil, err
 	}
 
 	opusCaps := webrtc.RTPCodecCapability{MimeType: "audio/opus", ClockRate: 48000,
-		Channels: 0, SDPFmtpLine: "", RTCPFeedback: nil}
+		Channels: 0, SDPFmtpLine: cl.fmtpLine(webrtc.MimeTypeOpus), RTCPFeedback: nil}
 
 	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
 		RTPCodecCapability: opusCaps,
 		PayloadType:        111,
 	}, webrtc.RTPCodecTypeAudio); err != nil {
-		return err
+		return nil, err
 	}
 
 	interceptReg := &interceptor.Registry{}
 	err := webrtc.ConfigureRTCPReports(interceptReg)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := cl.configureStats(interceptReg); err != nil {
+		return nil, err
+	}
+	if err := cl.configureCongestionControl(&m, interceptReg); err != nil {
+		return nil, err
+	}
+	if err := cl.configureRetransmission(interceptReg); err != nil {
+		return nil, err
+	}
+	if err := cl.configureInterceptors(&m, interceptReg); err != nil {
+		return nil, err
+	}
+
+	settingEngine, err := cl.settingEngine()
+	if err != nil {
+		return nil, err
 	}
 
 	// Create the API object with the MediaEngine
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(&m),
-		webrtc.WithInterceptorRegistry(interceptReg))
+	return webrtc.NewAPI(webrtc.WithMediaEngine(&m),
+		webrtc.WithInterceptorRegistry(interceptReg),
+		webrtc.WithSettingEngine(settingEngine)), nil
+}
+
+func (cl *Client) initStack(api *webrtc.API) (*webrtc.PeerConnection, *webrtc.DataChannel, error) {
 
 	// Prepare the configuration
 	config := webrtc.Configuration{
@@ -369,49 +744,72 @@ func (cl *Client) initStack(videoCodecMimeType string) error {
 			},
 		},
 	}
+	if cl.transport.relayOnly {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
 
 	// Create a new RTCPeerConnection
 	peerConnection, err := api.NewPeerConnection(config)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	peerConnection.OnNegotiationNeeded(func() {
 		//log.Println("Negotiation needed")
 	})
 
-	videoTrack, videoTrackErr := webrtc.NewTrackLocalStaticRTP(
-		webrtc.RTPCodecCapability{MimeType: videoCodecMimeType}, "video", "pion")
-	if videoTrackErr != nil {
-		return videoTrackErr
-	}
-
-	_, videoTrackErr = peerConnection.AddTrack(videoTrack)
-	if videoTrackErr != nil {
-		return videoTrackErr
-	}
-
-	audioTrack, audioTrackErr := webrtc.NewTrackLocalStaticRTP(
-		webrtc.RTPCodecCapability{MimeType: "audio/opus"}, "audio", "pion")
-	if audioTrackErr != nil {
-		return audioTrackErr
-	}
-
-	_, audioTrackErr = peerConnection.AddTrack(audioTrack)
-	if audioTrackErr != nil {
-		return audioTrackErr
+	if err := cl.addLocalMedia(peerConnection); err != nil {
+		peerConnection.Close()
+		return nil, nil, err
 	}
 
 	// Set the handler for ICE connection state
 	// This will notify you when the peer has connected/disconnected
 	peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
+		if peerConnection != cl.activePeerConnection() {
+			// stale peer connection replaced by a recovery
+			return
+		}
 		cl.logger.Info("ICE Connection State has changed: %s", connectionState.String())
+		cl.setConnectionState(ConnectionLayerICE, iceConnectionState(connectionState))
 		switch connectionState {
 		case webrtc.ICEConnectionStateConnected:
-			if cl.connectedHandler != nil {
-				cl.connectedHandler(true, videoTrack, audioTrack)
+			select {
+			case cl.iceConnectedCh <- struct{}{}:
+			default:
+			}
+			// With auto-reconnect the tracks stay the same, so
+			// only notify on the first connect.
+			cl.reconnectMu.Lock()
+			notified := cl.connectedNotified
+			cl.connectedNotified = true
+			cl.reconnectMu.Unlock()
+			if cl.reconnectPolicy != nil && notified {
+				return
+			}
+			videoWriter, audioWriter := cl.localWriters()
+			cl.handlerMu.RLock()
+			connectedHandler := cl.connectedHandler
+			cl.handlerMu.RUnlock()
+			if connectedHandler != nil {
+				connectedHandler(true, videoWriter, audioWriter)
 			}
+			cl.emit(Event{Type: EventConnected, VideoTrack: videoWriter, AudioTrack: audioWriter})
+		case webrtc.ICEConnectionStateDisconnected:
+			cl.startRecovery(false)
+		case webrtc.ICEConnectionStateFailed:
+			if cl.reconnectPolicy == nil {
+				cl.emitError(&CallError{Kind: ErrICEFailed, Op: "connect"})
+			}
+			cl.startRecovery(true)
+		}
+	})
+
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if peerConnection != cl.activePeerConnection() {
+			return
 		}
+		cl.setConnectionState(ConnectionLayerPeer, peerConnectionState(state))
 	})
 
 	peerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
@@ -421,12 +819,21 @@ func (cl *Client) initStack(videoCodecMimeType string) error {
 		// Without sending something over, the NO-DATA-RECEIVED will be triggered
 		// serverside (although this should not, cause STUN-binding messages should trigger
 		// this as well). Therefore send PLIs cyclically.
+		if !cl.enterRoutine() {
+			return
+		}
+		defer cl.routines.Done()
+
 		if track.Kind() == webrtc.RTPCodecTypeVideo {
-			go func() {
+			cl.startRoutine(func() {
 				pliTicker := time.NewTicker(10 * time.Second)
 				defer pliTicker.Stop()
 				for {
-					<-pliTicker.C
+					select {
+					case <-pliTicker.C:
+					case <-cl.closeCh:
+						return
+					}
 					errSend := peerConnection.WriteRTCP(
 						[]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}})
 					if errSend != nil {
@@ -434,27 +841,63 @@ func (cl *Client) initStack(videoCodecMimeType string) error {
 						return
 					}
 				}
-			}()
+			})
 		}
 
 		// Read from that track. If this is not done,
 		// no remote data is processed and hence no rtcp info
 		// would be updated. So read even if the data is not handeled.
+		remoteTrack := newRemoteTrack(track)
+		defer remoteTrack.end()
+		cl.handlerMu.RLock()
+		remoteTrackHandler := cl.remoteTrackHandler
+		cl.handlerMu.RUnlock()
+		if remoteTrackHandler != nil {
+			remoteTrackHandler(remoteTrack)
+		}
+		cl.emit(Event{Type: EventTrackAdded, Track: remoteTrack})
+
+		var assembler *frameAssembler
+		assemblerSupported := true
 		for {
 			rtpPacket, _, err := track.ReadRTP()
 			if err != nil {
 				return
 			}
+			remoteTrack.handlePacket(rtpPacket)
 
+			var receivedHandler MediaReceivedHandler
+			var frameHandler FrameHandler
+			cl.handlerMu.RLock()
 			if track.Kind() == webrtc.RTPCodecTypeVideo {
-				if cl.videoReceivedHandler != nil {
-					cl.videoReceivedHandler(rtpPacket)
-				}
+				receivedHandler = cl.videoReceivedHandler
+				frameHandler = cl.videoFrameHandler
 			} else {
-				if cl.audioReceivedHandler != nil {
-					cl.audioReceivedHandler(rtpPacket)
+				receivedHandler = cl.audioReceivedHandler
+				frameHandler = cl.audioFrameHandler
+			}
+			cl.handlerMu.RUnlock()
+			if receivedHandler != nil {
+				receivedHandler(rtpPacket)
+			}
+
+			if frameHandler == nil || !assemblerSupported {
+				continue
+			}
+			if assembler == nil {
+				assembler = newFrameAssembler(track.Codec(), cl.jitterBufferLatency, func() {
+					peerConnection.WriteRTCP(
+						[]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}})
+				})
+				if assembler == nil {
+					cl.logger.Warn("No frame assembly for codec %s", track.Codec().MimeType)
+					assemblerSupported = false
+					continue
 				}
 			}
+			for _, frame := range assembler.push(rtpPacket) {
+				frameHandler(frame)
+			}
 		}
 
 	})
@@ -471,7 +914,8 @@ func (cl *Client) initStack(videoCodecMimeType string) error {
 		dataChannel, err = peerConnection.CreateDataChannel("data",
 			&webrtc.DataChannelInit{Negotiated: &negotiated, ID: &identifier})
 		if err != nil {
-			return err
+			peerConnection.Close()
+			return nil, nil, err
 		}
 
 		// Register channel opening handling
@@ -483,89 +927,192 @@ func (cl *Client) initStack(videoCodecMimeType string) error {
 		dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
 			//log.Printf("Message from DataChannel '%s': '%s'\n", dataChannel.Label(), string(msg.Data))
 
-			type base struct {
-				MsgType string `json:"type"`
-			}
-
-			b := base{}
-			if err := json.Unmarshal(msg.Data, &b); err != nil {
+			confMsg, err := ParseConferenceMessage(msg.Data)
+			if err != nil {
 				cl.logger.Warn("Failed to unmarshal: %s", err)
 			}
-			if b.MsgType == "ping" {
+			if _, ok := confMsg.(*PingMessage); ok {
 				//fmt.Println("Ping received")
 				if cl.sendPong {
 					// sending pong
-					pong := base{MsgType: "pong"}
-					b, _ := json.Marshal(pong)
+					b, _ := MarshalConferenceMessage(&PongMessage{})
 					dataChannel.Send(b)
 				}
 			}
 
-			if cl.dataChannelReceivedHandler != nil {
-				cl.dataChannelReceivedHandler(msg.Data)
+			cl.handlerMu.RLock()
+			dataChannelHandler := cl.dataChannelReceivedHandler
+			conferenceEventHandler := cl.conferenceEventHandler
+			cl.handlerMu.RUnlock()
+
+			if dataChannelHandler != nil {
+				dataChannelHandler(msg.Data)
+			}
+			cl.emit(Event{Type: EventDataChannelMessage, Data: msg.Data})
+
+			if confMsg != nil {
+				if conferenceEventHandler != nil {
+					conferenceEventHandler(confMsg)
+				}
+				cl.emit(Event{Type: EventConferenceMessage, Message: confMsg})
 			}
 
 		})
 	}
 
-	cl.peerConnection = peerConnection
+	return peerConnection, dataChannel, nil
+}
 
-	return nil
+// addLocalMedia adds the transceivers for the wanted media kinds. Tracks
+// are kept across peer connections, so the application can continue
+// writing to them after a call recovery.
+func (cl *Client) addLocalMedia(peerConnection *webrtc.PeerConnection) error {
+
+	if cl.receiveOnly {
+		kinds := []webrtc.RTPCodecType{}
+		if !cl.noVideo {
+			kinds = append(kinds, webrtc.RTPCodecTypeVideo)
+		}
+		if !cl.noAudio {
+			kinds = append(kinds, webrtc.RTPCodecTypeAudio)
+		}
+		for _, kind := range kinds {
+			if _, err := peerConnection.AddTransceiverFromKind(kind,
+				webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+				return err
+			}
+		}
+		return cl.addLocalSenders(peerConnection)
+	}
+
+	if !cl.noVideo && cl.videoTrack == nil {
+		videoTrack := newLocalTrack(webrtc.RTPCodecTypeVideo,
+			cl.videoCodecPreferences(), "video", "pion")
+		videoTrack.mimeType = cl.NegotiatedVideoCodec
+		cl.videoTrack = videoTrack
+		var writer CodecWriter = videoTrack
+		if cl.pacerConfig != nil {
+			cl.pacer = newPacer(videoTrack, *cl.pacerConfig, cl.TargetBitrate, cl.closeCh)
+			cl.startRoutine(cl.pacer.run)
+			writer = cl.pacer
+		}
+		if cl.useKeyframeCache {
+			cl.keyframeCache = &KeyframeCache{writer: writer, mimeType: writer.MimeType}
+			writer = cl.keyframeCache
+		}
+		cl.videoSampleWriter = newSampleWriter(writer, writer.MimeType)
+		cl.tracksMu.Lock()
+		cl.localSenders = append(cl.localSenders, &localSender{
+			writer:            writer,
+			track:             videoTrack,
+			onKeyframeRequest: cl.onKeyframeRequest,
+		})
+		cl.tracksMu.Unlock()
+	}
+
+	if !cl.noAudio && cl.audioTrack == nil {
+		audioTrack := newLocalTrack(webrtc.RTPCodecTypeAudio,
+			[]string{webrtc.MimeTypeOpus}, "audio", "pion")
+		audioTrack.mimeType = func() string { return webrtc.MimeTypeOpus }
+		cl.audioTrack = audioTrack
+		cl.audioSampleWriter = newSampleWriter(audioTrack, audioTrack.MimeType)
+		cl.tracksMu.Lock()
+		cl.localSenders = append(cl.localSenders, &localSender{
+			writer: audioTrack,
+			track:  audioTrack,
+		})
+		cl.tracksMu.Unlock()
+	}
+
+	return cl.addLocalSenders(peerConnection)
 }
 
-func (cl *Client) createOffer() (string, error) {
-	offer, err := cl.peerConnection.CreateOffer(nil)
+// localWriters returns the writers handed out to the application. Writers
+// of media kinds not sent are nil.
+func (cl *Client) localWriters() (video RTPWriter, audio RTPWriter) {
+	if cl.keyframeCache != nil {
+		video = cl.keyframeCache
+	} else if cl.pacer != nil {
+		video = cl.pacer
+	} else if cl.videoTrack != nil {
+		video = cl.videoTrack
+	}
+	if cl.audioTrack != nil {
+		audio = cl.audioTrack
+	}
+	// removed via RemoveTrack
+	if video != nil && !cl.isSending(video) {
+		video = nil
+	}
+	if audio != nil && !cl.isSending(audio) {
+		audio = nil
+	}
+	return video, audio
+}
+
+// readSenderRTCP reads the rtcp packets of a local track. This is required
+// for the interceptors to process receiver reports and feedback.
+func (cl *Client) readSenderRTCP(sender *webrtc.RTPSender, onKeyframeRequest func()) {
+	for {
+		pkts, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			switch p := pkt.(type) {
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				cl.updateTargetBitrate(-1, int(p.Bitrate))
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				if onKeyframeRequest != nil {
+					onKeyframeRequest()
+				}
+			}
+		}
+	}
+}
+
+func (cl *Client) createOffer(ctx context.Context, options *webrtc.OfferOptions) (string, error) {
+	peerConnection := cl.activePeerConnection()
+	offer, err := peerConnection.CreateOffer(options)
 	if err != nil {
-		return "", err
+		return "", &CallError{Kind: ErrSignalingFailed, Op: "create offer", Err: err}
 	}
 
 	// wait until ice candidates are all ready
-	gatherComplete := webrtc.GatheringCompletePromise(cl.peerConnection)
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
 
 	// Sets the LocalDescription, and starts our UDP listeners
-	err = cl.peerConnection.SetLocalDescription(offer)
+	err = peerConnection.SetLocalDescription(offer)
 	if err != nil {
-		return "", err
+		return "", &CallError{Kind: ErrSignalingFailed, Op: "set local description", Err: err}
 	}
 
-	<-gatherComplete
-
-	newOffer := cl.peerConnection.LocalDescription().SDP
-
-	// add session attribute `sfu-capable` to our offer
-	// find first m line
-	if cl.sfuCapable {
-		firstMLineIdx := strings.Index(newOffer, "m=")
-		if firstMLineIdx >= 0 {
-			newOffer = newOffer[:firstMLineIdx] + "a=sfu-capable\r\n" + newOffer[firstMLineIdx:]
+	if cl.tricklingICE() && (options == nil || !options.ICERestart) {
+		// candidates are sent as they are gathered
+		sdp, err := cl.localSDP("offer", offer.SDP)
+		if err != nil {
+			return "", &CallError{Kind: ErrSignalingFailed, Op: "create offer", Err: err}
 		}
+		return sdp, nil
 	}
 
-	if cl.useConfProtocol {
-		// add session attribute `eyeson-datachan-capable` and `eyeson-datachan-keepalive`
-		firstMLineIdx := strings.Index(newOffer, "m=")
-		if firstMLineIdx >= 0 {
-			sAttribs := []string{
-				"a=eyeson-datachan-capable",
-				"a=eyeson-datachan-keepalive",
-			}
-			if cl.sendMessagesViaSEPP {
-				sAttribs = append(sAttribs, "a=eyeson-sepp-messaging")
-			}
-			newOffer = newOffer[:firstMLineIdx] + strings.Join(sAttribs, "\r\n") + "\r\n" + newOffer[firstMLineIdx:]
-		}
+	select {
+	case <-gatherComplete:
+	case <-ctx.Done():
+		return "", &CallError{Kind: ErrCallAborted, Op: "gather candidates",
+			Err: contextError(ctx, ctx.Err())}
 	}
 
-	if cl.sendOnly {
-		// modify sendrecv -> sendonly
-		newOffer = strings.ReplaceAll(newOffer, "a=sendrecv", "a=sendonly")
+	sdp, err := cl.localSDP("offer", peerConnection.LocalDescription().SDP)
+	if err != nil {
+		return "", &CallError{Kind: ErrSignalingFailed, Op: "create offer", Err: err}
 	}
-
-	return newOffer, nil
+	return sdp, nil
 }
 
-func onSdpUpdate(call *gosepp.Call, pc *webrtc.PeerConnection, sdp gosepp.Sdp,
-	logger gosepp.Logger) {
+func (cl *Client) onSdpUpdate(call signalingCall, pc *webrtc.PeerConnection, sdp gosepp.Sdp) {
+	logger := cl.logger
+	cl.observeRemoteSDP(sdp.SdpType, sdp.Sdp)
 	switch sdp.SdpType {
 	case "offer":
 		offer := webrtc.SessionDescription{
@@ -573,9 +1120,16 @@ func onSdpUpdate(call *gosepp.Call, pc *webrtc.PeerConnection, sdp gosepp.Sdp,
 			SDP:  sdp.Sdp,
 		}
 
+		// the offer of the conference wins over a pending one of ours,
+		// which is sent again after the answer.
+		if rollbackOffer(pc) {
+			defer cl.answerApplied(errOfferRolledBack)
+		}
+
 		err := pc.SetRemoteDescription(offer)
 		if err != nil {
 			logger.Warn("Failed to set remote description: %s", err)
+			cl.emitError(&CallError{Kind: ErrSDPRejected, Op: "set remote description", Err: err})
 			return
 		}
 
@@ -583,6 +1137,7 @@ func onSdpUpdate(call *gosepp.Call, pc *webrtc.PeerConnection, sdp gosepp.Sdp,
 		answer, err := pc.CreateAnswer(nil)
 		if err != nil {
 			logger.Warn("Failed to create answer: %s", err)
+			cl.emitError(&CallError{Kind: ErrSignalingFailed, Op: "create answer", Err: err})
 			return
 		}
 
@@ -590,13 +1145,43 @@ func onSdpUpdate(call *gosepp.Call, pc *webrtc.PeerConnection, sdp gosepp.Sdp,
 		err = pc.SetLocalDescription(answer)
 		if err != nil {
 			logger.Warn("Failed to set local description: %s", err)
+			cl.emitError(&CallError{Kind: ErrSignalingFailed, Op: "set local description", Err: err})
+			return
+		}
+
+		answerSDP, err := cl.localSDP("answer", answer.SDP)
+		if err != nil {
+			logger.Warn("Failed to prepare answer: %s", err)
+			cl.emitError(&CallError{Kind: ErrSignalingFailed, Op: "create answer", Err: err})
 			return
 		}
 
 		if err = call.UpdateSDP(context.Background(),
-			gosepp.Sdp{SdpType: "answer", Sdp: answer.SDP}); err != nil {
+			gosepp.Sdp{SdpType: "answer", Sdp: answerSDP}); err != nil {
 			logger.Warn("failed to send message:", err)
+			cl.emitError(&CallError{Kind: ErrSignalingFailed, Op: "send answer", Err: err})
+			return
+		}
+	case "answer":
+		// answer to our own offer, see negotiate
+		answer := webrtc.SessionDescription{
+			Type: webrtc.SDPTypeAnswer,
+			SDP:  sdp.Sdp,
+		}
+
+		cl.answerMu.Lock()
+		pending := cl.answerCh != nil
+		cl.answerMu.Unlock()
+		if !pending {
+			logger.Warn("Ignoring answer without pending offer")
+			return
+		}
+
+		if err := pc.SetRemoteDescription(answer); err != nil {
+			logger.Warn("Failed to set remote description: %s", err)
+			cl.answerApplied(&CallError{Kind: ErrSDPRejected, Op: "set remote description", Err: err})
 			return
 		}
+		cl.answerApplied(nil)
 	}
 }
@@ -0,0 +1,572 @@
+package ghost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eyeson-team/gosepp/v3"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// testConference answers the offers of the client with a local peer
+// connection instead of a signaling server.
+type testConference struct {
+	mu    sync.Mutex
+	calls []*testCall
+	// trickle ice is supported by the signaling or announced in the
+	// answers
+	trickleSignaling bool
+	trickleAnswer    bool
+}
+
+func (tc *testConference) newCall() (signalingCall, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	call := &testCall{trickleSignaling: tc.trickleSignaling, trickleAnswer: tc.trickleAnswer}
+	tc.calls = append(tc.calls, call)
+	return call, nil
+}
+
+func (tc *testConference) call(i int) *testCall {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if i >= len(tc.calls) {
+		return nil
+	}
+	return tc.calls[i]
+}
+
+type testCall struct {
+	mu                sync.Mutex
+	remote            *webrtc.PeerConnection
+	sdpHandler        func(sdp gosepp.Sdp)
+	terminatedHandler func()
+	candidateHandler  func(candidate webrtc.ICECandidateInit)
+	trickleSignaling  bool
+	trickleAnswer     bool
+	offers            []string
+	candidates        int
+	messaging         bool
+	messages          [][]byte
+	// the next offer of the client is rejected or crossed by an offer of
+	// the conference
+	rejectOffer bool
+	crossOffer  bool
+}
+
+func (c *testCall) Start(ctx context.Context, offer gosepp.Sdp, displayname string) (gosepp.Sdp, error) {
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return gosepp.Sdp{}, err
+	}
+	remote.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+	if c.trickleSignaling {
+		remote.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			c.mu.Lock()
+			handler := c.candidateHandler
+			c.mu.Unlock()
+			if candidate != nil && handler != nil {
+				handler(candidate.ToJSON())
+			}
+		})
+	}
+	c.mu.Lock()
+	c.remote = remote
+	c.mu.Unlock()
+	return c.answer(offer)
+}
+
+func (c *testCall) answer(offer gosepp.Sdp) (gosepp.Sdp, error) {
+	c.mu.Lock()
+	remote := c.remote
+	c.offers = append(c.offers, offer.Sdp)
+	c.mu.Unlock()
+
+	if err := remote.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer, SDP: offer.Sdp}); err != nil {
+		return gosepp.Sdp{}, err
+	}
+	answer, err := remote.CreateAnswer(nil)
+	if err != nil {
+		return gosepp.Sdp{}, err
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(remote)
+	if err := remote.SetLocalDescription(answer); err != nil {
+		return gosepp.Sdp{}, err
+	}
+	<-gatherComplete
+	sdp := remote.LocalDescription().SDP
+	if c.trickleAnswer {
+		sdp = strings.Replace(sdp, "t=0 0\r\n", "t=0 0\r\na=ice-options:trickle\r\n", 1)
+	}
+	return gosepp.Sdp{SdpType: "answer", Sdp: sdp}, nil
+}
+
+// UpdateSDP answers via the sdp-update handler. A closed conference
+// doesn't answer.
+func (c *testCall) UpdateSDP(ctx context.Context, sdp gosepp.Sdp) error {
+	c.mu.Lock()
+	remote := c.remote
+	handler := c.sdpHandler
+	reject, cross := c.rejectOffer, c.crossOffer
+	c.rejectOffer, c.crossOffer = false, false
+	c.mu.Unlock()
+
+	if sdp.SdpType == "answer" {
+		return remote.SetRemoteDescription(webrtc.SessionDescription{
+			Type: webrtc.SDPTypeAnswer, SDP: sdp.Sdp})
+	}
+	go func() {
+		switch {
+		case reject:
+			handler(gosepp.Sdp{SdpType: "answer", Sdp: "invalid"})
+		case cross:
+			// the offer of the client is dropped
+			offer, err := remote.CreateOffer(nil)
+			if err != nil {
+				return
+			}
+			gatherComplete := webrtc.GatheringCompletePromise(remote)
+			if err := remote.SetLocalDescription(offer); err != nil {
+				return
+			}
+			<-gatherComplete
+			handler(gosepp.Sdp{SdpType: "offer", Sdp: remote.LocalDescription().SDP})
+		default:
+			answer, err := c.answer(sdp)
+			if err != nil {
+				return
+			}
+			handler(answer)
+		}
+	}()
+	return nil
+}
+
+func (c *testCall) Terminate(ctx context.Context) error {
+	c.mu.Lock()
+	handler := c.terminatedHandler
+	c.mu.Unlock()
+	go handler()
+	return nil
+}
+
+func (c *testCall) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.remote != nil {
+		c.remote.Close()
+	}
+}
+
+func (c *testCall) SetSDPUpdateHandler(handler func(sdp gosepp.Sdp)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sdpHandler = handler
+}
+
+func (c *testCall) SetTerminatedHandler(handler func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.terminatedHandler = handler
+}
+
+func (c *testCall) TrickleICE() bool {
+	return c.trickleSignaling
+}
+
+func (c *testCall) SendICECandidate(ctx context.Context, candidate webrtc.ICECandidateInit) error {
+	c.mu.Lock()
+	remote := c.remote
+	c.candidates++
+	c.mu.Unlock()
+	return remote.AddICECandidate(candidate)
+}
+
+func (c *testCall) SetICECandidateHandler(handler func(candidate webrtc.ICECandidateInit)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.candidateHandler = handler
+}
+
+func (c *testCall) Messaging() bool {
+	return c.messaging
+}
+
+func (c *testCall) SendMessage(ctx context.Context, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, data)
+	return nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the recovery waits for ice to disconnect")
+	}
+
+	conference := &testConference{}
+	cl := newClient(testCallInfo{},
+		WithAutoReconnect(ReconnectPolicy{
+			DisconnectedTimeout: 100 * time.Millisecond,
+			ICERestartTimeout:   time.Second,
+			InitialBackoff:      10 * time.Millisecond,
+		}),
+		func(h *Client) { h.newSignalingCall = conference.newCall })
+	if _, _, err := cl.initConnection(); err != nil {
+		t.Fatal(err)
+	}
+
+	eventsDone := make(chan struct{})
+	events := cl.Events()
+	go func() {
+		defer close(eventsDone)
+		for range events {
+		}
+	}()
+
+	var connected int32
+	connectedHandler := func(bool, RTPWriter, RTPWriter) {
+		atomic.AddInt32(&connected, 1)
+	}
+
+	// handlers are replaced while the call is running
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Millisecond):
+				}
+				cl.SetConnectedHandler(connectedHandler)
+				cl.SetConnectionStateHandler(func(ConnectionLayer, ConnectionState) {})
+				cl.SetTerminatedHandler(func() {})
+				cl.SetVideoReceivedHandler(func(*rtp.Packet) {})
+				cl.SetAudioReceivedHandler(func(*rtp.Packet) {})
+				cl.SetRemoteTrackHandler(func(*RemoteTrack) {})
+				cl.SetKeyframeRequestHandler(func() {})
+				cl.SetDataChannelHandler(func([]byte) {})
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		packet := &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0xf8, 0xff, 0xfe}}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			packet.SequenceNumber++
+			packet.Timestamp += 960
+			cl.audioTrack.WriteRTP(packet)
+		}
+	}()
+
+	isConnected := func() bool {
+		return cl.activePeerConnection().ICEConnectionState() == webrtc.ICEConnectionStateConnected
+	}
+	isStable := func() bool {
+		return cl.activePeerConnection().SignalingState() == webrtc.SignalingStateStable
+	}
+
+	if err := cl.Call(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "connect", isConnected)
+	firstPeerConnection := cl.activePeerConnection()
+
+	// the conference is lost, ice restart is not answered, so re-call
+	conference.call(0).Close()
+	waitFor(t, "recovery", func() bool {
+		return conference.call(1) != nil && cl.activePeerConnection() != firstPeerConnection &&
+			isConnected()
+	})
+
+	// track changes are negotiated one after the other and return once
+	// the answer is applied
+	var changes sync.WaitGroup
+	tracks := make([]*LocalTrack, 2)
+	errs := make([]error, 2)
+	changes.Add(2)
+	go func() {
+		defer changes.Done()
+		tracks[0], errs[0] = cl.AddAudioTrack("second")
+	}()
+	go func() {
+		defer changes.Done()
+		tracks[1], errs[1] = cl.AddVideoTrack("screen")
+	}()
+	changes.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !isStable() {
+		t.Fatal("answer not applied")
+	}
+	if err := cl.SetAudioMuted(true); err != nil {
+		t.Fatal(err)
+	}
+	if !isStable() {
+		t.Fatal("answer not applied")
+	}
+	for _, track := range tracks {
+		if err := cl.RemoveTrack(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cl.RemoveTrack(tracks[0]); !errors.Is(err, ErrTrackNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrTrackNotFound)
+	}
+	if !isStable() {
+		t.Fatal("answer not applied")
+	}
+
+	close(stop)
+	wg.Wait()
+
+	var destroyed sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		destroyed.Add(1)
+		go func() {
+			defer destroyed.Done()
+			cl.Destroy()
+		}()
+	}
+	destroyed.Wait()
+	cl.Destroy()
+
+	select {
+	case <-eventsDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("events channel not closed")
+	}
+	if n := atomic.LoadInt32(&connected); n != 1 {
+		t.Fatalf("connected handler called %d times, want 1", n)
+	}
+}
+
+func TestClientRenegotiation(t *testing.T) {
+	conference := &testConference{}
+	cl := newClient(testCallInfo{}, func(h *Client) { h.newSignalingCall = conference.newCall })
+	defer cl.Destroy()
+	if _, _, err := cl.initConnection(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Call(); err != nil {
+		t.Fatal(err)
+	}
+	call := conference.call(0)
+	isStable := func() bool {
+		return cl.activePeerConnection().SignalingState() == webrtc.SignalingStateStable
+	}
+
+	// a crossing offer of the conference is answered first
+	call.mu.Lock()
+	call.crossOffer = true
+	call.mu.Unlock()
+	track, err := cl.AddAudioTrack("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isStable() {
+		t.Fatal("answer not applied")
+	}
+
+	// a rejected answer is returned and the track is not sent
+	call.mu.Lock()
+	call.rejectOffer = true
+	call.mu.Unlock()
+	if _, err := cl.AddVideoTrack("screen"); !errors.Is(err, ErrSDPRejected) {
+		t.Fatalf("got error %v, want %v", err, ErrSDPRejected)
+	}
+	if !isStable() {
+		t.Fatal("offer not rolled back")
+	}
+	if n := len(cl.localSenders); n != 3 {
+		t.Fatalf("got %d local tracks, want 3", n)
+	}
+
+	// a rejected mute is undone
+	audioTransceiver := cl.localSenders[1].transceiver
+	sending := audioTransceiver.Direction()
+	call.mu.Lock()
+	call.rejectOffer = true
+	call.mu.Unlock()
+	if err := cl.SetAudioMuted(true); !errors.Is(err, ErrSDPRejected) {
+		t.Fatalf("got error %v, want %v", err, ErrSDPRejected)
+	}
+	if direction := audioTransceiver.Direction(); direction != sending {
+		t.Fatalf("audio is %s after failed mute, want %s", direction, sending)
+	}
+
+	// mute changes reuse the audio transceiver
+	transceivers := len(cl.activePeerConnection().GetTransceivers())
+	for _, muted := range []bool{true, false, true, false} {
+		if err := cl.SetAudioMuted(muted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(cl.activePeerConnection().GetTransceivers()); n != transceivers {
+		t.Fatalf("got %d transceivers, want %d", n, transceivers)
+	}
+	if direction := audioTransceiver.Direction(); direction != sending {
+		t.Fatalf("audio is %s after unmute, want %s", direction, sending)
+	}
+	if err := cl.RemoveTrack(track); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTrickleICE(t *testing.T) {
+	tests := []struct {
+		name             string
+		trickleSignaling bool
+		trickleAnswer    bool
+		// offers without and with all candidates
+		trickled, full int
+	}{
+		{"trickle", true, true, 1, 0},
+		{"signaling without trickle", false, false, 0, 1},
+		{"answer without trickle", true, false, 1, 1},
+	}
+
+	hasCandidates := func(offer string) bool {
+		for _, media := range parseSDP(t, offer).MediaDescriptions {
+			if _, ok := media.Attribute("candidate"); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conference := &testConference{trickleSignaling: tt.trickleSignaling,
+				trickleAnswer: tt.trickleAnswer}
+			cl := newClient(testCallInfo{}, WithTrickleICE(),
+				func(h *Client) { h.newSignalingCall = conference.newCall })
+			defer cl.Destroy()
+			if _, _, err := cl.initConnection(); err != nil {
+				t.Fatal(err)
+			}
+			if err := cl.Call(); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "connect", func() bool {
+				return cl.activePeerConnection().ICEConnectionState() == webrtc.ICEConnectionStateConnected
+			})
+
+			call := conference.call(0)
+			call.mu.Lock()
+			defer call.mu.Unlock()
+			trickled, full := 0, 0
+			for _, offer := range call.offers {
+				if hasCandidates(offer) {
+					full++
+				} else {
+					trickled++
+				}
+			}
+			if trickled != tt.trickled || full != tt.full {
+				t.Fatalf("got %d trickled and %d full offers, want %d and %d",
+					trickled, full, tt.trickled, tt.full)
+			}
+			if sent := call.candidates > 0; sent != (tt.trickled > 0 && tt.full == 0) {
+				t.Fatalf("got %d candidates sent", call.candidates)
+			}
+		})
+	}
+}
+
+// invalidTurnCallInfo makes the creation of the peer connection fail.
+type invalidTurnCallInfo struct {
+	testCallInfo
+}
+
+func (invalidTurnCallInfo) GetTurnServerURLs() []string { return []string{"invalid"} }
+
+func TestNewClientReleasesTransport(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	if _, err := NewClient(invalidTurnCallInfo{}, WithUDPMuxPort(port)); !errors.Is(err, ErrSetupFailed) {
+		t.Fatalf("got error %v, want %v", err, ErrSetupFailed)
+	}
+	// the mux port is free again
+	conn, err = net.ListenPacket("udp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatalf("udp mux port not released: %s", err)
+	}
+	conn.Close()
+}
+
+func TestNegotiatedVideoCodecAfterRecall(t *testing.T) {
+	conference := &testConference{}
+	cl := newClient(testCallInfo{}, func(h *Client) { h.newSignalingCall = conference.newCall })
+	defer cl.Destroy()
+	if _, _, err := cl.initConnection(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Call(); err != nil {
+		t.Fatal(err)
+	}
+	if cl.NegotiatedVideoCodec() == "" {
+		t.Fatal("video codec not negotiated")
+	}
+
+	// the track is still bound by the previous peer connection
+	oldPeerConnection, oldCall, err := cl.initConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldCall.Close()
+	defer oldPeerConnection.Close()
+	if codec := cl.NegotiatedVideoCodec(); codec != "" {
+		t.Fatalf("got video codec %q before the re-call, want none", codec)
+	}
+	if err := cl.Call(); err != nil {
+		t.Fatal(err)
+	}
+	if cl.NegotiatedVideoCodec() == "" {
+		t.Fatal("video codec not negotiated after the re-call")
+	}
+}
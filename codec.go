@@ -0,0 +1,356 @@
+package ghost
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// first payload type of the registered video codecs
+const videoPayloadTypeBase = 96
+
+// CodecWriter is implemented by the local video track handed out via the
+// ConnectedHandler. MimeType returns the video codec negotiated with the
+// conference, which determines the packetizer the source has to use.
+type CodecWriter interface {
+	RTPWriter
+	MimeType() string
+}
+
+// WithVideoCodecPreferences offers several video codecs in the given order
+// of preference, e.g. webrtc.MimeTypeH265, webrtc.MimeTypeH264. The call
+// falls back to the next codec if the conference rejects one. Overrides
+// the WithForce*Codec options.
+func WithVideoCodecPreferences(mimeTypes ...string) ClientOption {
+	return func(h *Client) {
+		h.videoCodecs = mimeTypes
+	}
+}
+
+// videoCodecPreferences returns the offered video codecs.
+func (cl *Client) videoCodecPreferences() []string {
+	if len(cl.videoCodecs) > 0 {
+		return cl.videoCodecs
+	}
+	return []string{cl.videoCodec}
+}
+
+// registerVideoCodecs registers the preferred video codecs with distinct
+// payload types.
+func (cl *Client) registerVideoCodecs(m *webrtc.MediaEngine,
+	feedbacks []webrtc.RTCPFeedback) error {
+	for i, mimeType := range cl.videoCodecPreferences() {
+		videoCaps := webrtc.RTPCodecCapability{MimeType: mimeType, ClockRate: 90000,
+			Channels: 0, SDPFmtpLine: cl.fmtpLine(mimeType), RTCPFeedback: feedbacks}
+
+		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: videoCaps,
+			PayloadType:        webrtc.PayloadType(videoPayloadTypeBase + i),
+		}, webrtc.RTPCodecTypeVideo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NegotiatedVideoCodec returns the mime type of the video codec agreed on
+// with the conference or an empty string if not negotiated yet. It is
+// available within the ConnectedHandler.
+func (cl *Client) NegotiatedVideoCodec() string {
+	pc := cl.activePeerConnection()
+	if pc == nil || pc.CurrentRemoteDescription() == nil {
+		return ""
+	}
+	// the codec bound by the current sender of the video track
+	if cl.videoTrack != nil {
+		for _, transceiver := range pc.GetTransceivers() {
+			sender := transceiver.Sender()
+			if sender == nil || sender.Track() != cl.videoTrack {
+				continue
+			}
+			for _, encoding := range sender.GetParameters().Encodings {
+				if mimeType := cl.videoTrack.boundMimeTypeOf(encoding.SSRC); mimeType != "" {
+					return mimeType
+				}
+			}
+		}
+	}
+
+	for _, transceiver := range pc.GetTransceivers() {
+		if transceiver.Kind() != webrtc.RTPCodecTypeVideo {
+			continue
+		}
+		var codecs []webrtc.RTPCodecParameters
+		if sender := transceiver.Sender(); sender != nil {
+			codecs = sender.GetParameters().Codecs
+		} else if receiver := transceiver.Receiver(); receiver != nil {
+			codecs = receiver.GetParameters().Codecs
+		}
+		// codecs are ordered by the preference of the answer
+		for _, codec := range codecs {
+			if cl.isPreferredVideoCodec(codec.MimeType) {
+				return codec.MimeType
+			}
+		}
+	}
+	return ""
+}
+
+func (cl *Client) isPreferredVideoCodec(mimeType string) bool {
+	for _, preferred := range cl.videoCodecPreferences() {
+		if strings.EqualFold(preferred, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// localTrack is a local track accepting any of the offered codecs. Unlike
+// webrtc.TrackLocalStaticRTP the codec is chosen during negotiation, the
+// writer has to packetize accordingly.
+type localTrack struct {
+	id        string
+	streamID  string
+	kind      webrtc.RTPCodecType
+	mimeTypes []string
+	// mimeType is used as long as the track is not bound
+	mimeType func() string
+
+	mu       sync.RWMutex
+	bindings []localTrackBinding
+	muted    bool
+}
+
+type localTrackBinding struct {
+	id          string
+	ssrc        webrtc.SSRC
+	payloadType webrtc.PayloadType
+	codec       webrtc.RTPCodecParameters
+	writeStream webrtc.TrackLocalWriter
+}
+
+func newLocalTrack(kind webrtc.RTPCodecType, mimeTypes []string, id,
+	streamID string) *localTrack {
+	return &localTrack{id: id, streamID: streamID, kind: kind, mimeTypes: mimeTypes}
+}
+
+// Bind implements webrtc.TrackLocal. The first negotiated codec which was
+// offered is used.
+func (lt *localTrack) Bind(t webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	for _, codec := range t.CodecParameters() {
+		for _, mimeType := range lt.mimeTypes {
+			if !strings.EqualFold(codec.MimeType, mimeType) {
+				continue
+			}
+			lt.mu.Lock()
+			defer lt.mu.Unlock()
+			lt.bindings = append(lt.bindings, localTrackBinding{
+				id:          t.ID(),
+				ssrc:        t.SSRC(),
+				payloadType: codec.PayloadType,
+				codec:       codec,
+				writeStream: t.WriteStream(),
+			})
+			return codec, nil
+		}
+	}
+	return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+}
+
+// Unbind implements webrtc.TrackLocal
+func (lt *localTrack) Unbind(t webrtc.TrackLocalContext) error {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for i := range lt.bindings {
+		if lt.bindings[i].id == t.ID() {
+			lt.bindings = append(lt.bindings[:i], lt.bindings[i+1:]...)
+			return nil
+		}
+	}
+	return webrtc.ErrUnbindFailed
+}
+
+// ID implements webrtc.TrackLocal
+func (lt *localTrack) ID() string { return lt.id }
+
+// RID implements webrtc.TrackLocal
+func (lt *localTrack) RID() string { return "" }
+
+// StreamID implements webrtc.TrackLocal
+func (lt *localTrack) StreamID() string { return lt.streamID }
+
+// Kind implements webrtc.TrackLocal
+func (lt *localTrack) Kind() webrtc.RTPCodecType { return lt.kind }
+
+// MimeType implements CodecWriter
+func (lt *localTrack) MimeType() string {
+	if mimeType := lt.boundMimeType(); mimeType != "" {
+		return mimeType
+	}
+	if lt.mimeType != nil {
+		return lt.mimeType()
+	}
+	return ""
+}
+
+// setMuted drops the packets written while muted. Returns true if the
+// state changed.
+func (lt *localTrack) setMuted(muted bool) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	changed := lt.muted != muted
+	lt.muted = muted
+	return changed
+}
+
+// boundMimeType returns the codec of the latest binding.
+func (lt *localTrack) boundMimeType() string {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+	if len(lt.bindings) == 0 {
+		return ""
+	}
+	return lt.bindings[len(lt.bindings)-1].codec.MimeType
+}
+
+// boundMimeTypeOf returns the codec bound by the sender of ssrc.
+func (lt *localTrack) boundMimeTypeOf(ssrc webrtc.SSRC) string {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+	for _, b := range lt.bindings {
+		if b.ssrc == ssrc {
+			return b.codec.MimeType
+		}
+	}
+	return ""
+}
+
+// WriteRTP implements RTPWriter. SSRC and payload type are set per peer
+// connection. Packets are dropped while muted.
+func (lt *localTrack) WriteRTP(p *rtp.Packet) error {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+	if lt.muted {
+		return nil
+	}
+
+	var writeErr error
+	for _, b := range lt.bindings {
+		header := p.Header
+		header.SSRC = uint32(b.ssrc)
+		header.PayloadType = uint8(b.payloadType)
+		if _, err := b.writeStream.WriteRTP(&header, p.Payload); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+	return writeErr
+}
+
+// WithCodecParameters sets the fmtp line advertised for a codec, e.g.
+//
+//	WithCodecParameters(webrtc.MimeTypeH264,
+//		H264Parameters{ProfileLevelID: "640032", PacketizationMode: 1}.Fmtp())
+//	WithCodecParameters(webrtc.MimeTypeOpus,
+//		OpusParameters{Stereo: true, UseInbandFEC: true}.Fmtp())
+func WithCodecParameters(mimeType string, fmtp string) ClientOption {
+	return func(h *Client) {
+		if h.codecFmtp == nil {
+			h.codecFmtp = map[string]string{}
+		}
+		h.codecFmtp[strings.ToLower(mimeType)] = fmtp
+	}
+}
+
+// fmtpLine returns the configured fmtp line of a codec.
+func (cl *Client) fmtpLine(mimeType string) string {
+	return cl.codecFmtp[strings.ToLower(mimeType)]
+}
+
+// H264Parameters fmtp parameters of H264 (RFC 6184). PacketizationMode
+// defaults to 1 (non-interleaved), the mode of the fragmenting payloader,
+// mode 0 can't be advertised.
+type H264Parameters struct {
+	// ProfileLevelID hex encoded profile_idc, constraint flags and
+	// level_idc, e.g. "42e01f" (constrained baseline 3.1) or "640032"
+	// (high 5.0).
+	ProfileLevelID        string
+	PacketizationMode     int
+	LevelAsymmetryAllowed bool
+}
+
+// Fmtp returns the fmtp line.
+func (p H264Parameters) Fmtp() string {
+	params := []string{}
+	if p.LevelAsymmetryAllowed {
+		params = append(params, "level-asymmetry-allowed=1")
+	}
+	packetizationMode := p.PacketizationMode
+	if packetizationMode == 0 {
+		packetizationMode = 1
+	}
+	params = append(params, fmt.Sprintf("packetization-mode=%d", packetizationMode))
+	if p.ProfileLevelID != "" {
+		params = append(params, "profile-level-id="+p.ProfileLevelID)
+	}
+	return strings.Join(params, ";")
+}
+
+// VP9Parameters fmtp parameters of VP9.
+type VP9Parameters struct {
+	ProfileID int
+}
+
+// Fmtp returns the fmtp line.
+func (p VP9Parameters) Fmtp() string {
+	return fmt.Sprintf("profile-id=%d", p.ProfileID)
+}
+
+// AV1Parameters fmtp parameters of AV1. LevelIdx defaults to 5 (level 3.1).
+type AV1Parameters struct {
+	Profile  int
+	LevelIdx int
+	Tier     int
+}
+
+// Fmtp returns the fmtp line.
+func (p AV1Parameters) Fmtp() string {
+	levelIdx := p.LevelIdx
+	if levelIdx == 0 {
+		levelIdx = 5
+	}
+	return fmt.Sprintf("profile=%d;level-idx=%d;tier=%d", p.Profile, levelIdx, p.Tier)
+}
+
+// OpusParameters fmtp parameters of Opus (RFC 7587). Zero values are
+// omitted.
+type OpusParameters struct {
+	Stereo       bool
+	UseInbandFEC bool
+	// MaxAverageBitrate in bits per second.
+	MaxAverageBitrate int
+	// MinPTime minimum packet duration in milliseconds. The packet
+	// duration itself is the a=ptime media attribute, see
+	// WithLocalSDPMutator.
+	MinPTime int
+}
+
+// Fmtp returns the fmtp line.
+func (p OpusParameters) Fmtp() string {
+	params := []string{}
+	if p.MinPTime > 0 {
+		params = append(params, fmt.Sprintf("minptime=%d", p.MinPTime))
+	}
+	if p.UseInbandFEC {
+		params = append(params, "useinbandfec=1")
+	}
+	if p.Stereo {
+		params = append(params, "stereo=1", "sprop-stereo=1")
+	}
+	if p.MaxAverageBitrate > 0 {
+		params = append(params, fmt.Sprintf("maxaveragebitrate=%d", p.MaxAverageBitrate))
+	}
+	return strings.Join(params, ";")
+}
@@ -0,0 +1,169 @@
+package ghost
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ConferenceMessage is a typed message of the confserver protocol
+// exchanged via data-channel.
+type ConferenceMessage interface {
+	// MessageType returns the value of the `type` field.
+	MessageType() string
+}
+
+// ConferenceEventHandler called for each message of the confserver protocol
+// received via data-channel. Messages of unregistered types are passed as
+// *RawConferenceMessage.
+type ConferenceEventHandler func(msg ConferenceMessage)
+
+// PingMessage keepalive sent by the confserver. Answered automatically
+// with a PongMessage.
+type PingMessage struct{}
+
+// MessageType implements ConferenceMessage
+func (m *PingMessage) MessageType() string { return "ping" }
+
+// PongMessage answer to a PingMessage.
+type PongMessage struct{}
+
+// MessageType implements ConferenceMessage
+func (m *PongMessage) MessageType() string { return "pong" }
+
+// VoiceActivityMessage signals that a participant started or stopped
+// speaking.
+type VoiceActivityMessage struct {
+	ClientID string `json:"cid"`
+	On       bool   `json:"on"`
+}
+
+// MessageType implements ConferenceMessage
+func (m *VoiceActivityMessage) MessageType() string { return "voice_activity" }
+
+// MuteVideoMessage signals that a participant muted or unmuted the video.
+type MuteVideoMessage struct {
+	ClientID string `json:"cid"`
+	On       bool   `json:"on"`
+}
+
+// MessageType implements ConferenceMessage
+func (m *MuteVideoMessage) MessageType() string { return "mute_video" }
+
+// Member entry of a MemberListMessage.
+type Member struct {
+	ClientID string `json:"cid"`
+	Platform string `json:"p,omitempty"`
+}
+
+// MemberListMessage contains the participants which joined or left the
+// conference.
+type MemberListMessage struct {
+	Count   int      `json:"count"`
+	Added   []Member `json:"add,omitempty"`
+	Deleted []string `json:"del,omitempty"`
+}
+
+// MessageType implements ConferenceMessage
+func (m *MemberListMessage) MessageType() string { return "memberlist" }
+
+// SourceUpdateMessage describes the current layout and which participant
+// is shown at which position.
+type SourceUpdateMessage struct {
+	Layout       int      `json:"l"`
+	Sources      []string `json:"src,omitempty"`
+	Broadcasters []string `json:"bcst,omitempty"`
+	Dimensions   []Rect   `json:"dims,omitempty"`
+}
+
+// MessageType implements ConferenceMessage
+func (m *SourceUpdateMessage) MessageType() string { return "source_update" }
+
+// Rect position of a source within the layout.
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"w"`
+	Height int `json:"h"`
+}
+
+// RawConferenceMessage holds a message of a type which has not been
+// registered.
+type RawConferenceMessage struct {
+	Type string
+	Data []byte
+}
+
+// MessageType implements ConferenceMessage
+func (m *RawConferenceMessage) MessageType() string { return m.Type }
+
+var (
+	conferenceMessagesMu sync.RWMutex
+	conferenceMessages   = map[string]func() ConferenceMessage{
+		"ping":           func() ConferenceMessage { return &PingMessage{} },
+		"pong":           func() ConferenceMessage { return &PongMessage{} },
+		"voice_activity": func() ConferenceMessage { return &VoiceActivityMessage{} },
+		"mute_video":     func() ConferenceMessage { return &MuteVideoMessage{} },
+		"memberlist":     func() ConferenceMessage { return &MemberListMessage{} },
+		"source_update":  func() ConferenceMessage { return &SourceUpdateMessage{} },
+	}
+)
+
+// RegisterConferenceMessage registers a message type, so it is parsed into
+// the message returned by newMsg. Registering an existing type replaces it.
+func RegisterConferenceMessage(msgType string, newMsg func() ConferenceMessage) {
+	conferenceMessagesMu.Lock()
+	defer conferenceMessagesMu.Unlock()
+	conferenceMessages[msgType] = newMsg
+}
+
+// ParseConferenceMessage parses a confserver protocol message.
+func ParseConferenceMessage(data []byte) (ConferenceMessage, error) {
+	type base struct {
+		MsgType string `json:"type"`
+	}
+
+	b := base{}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+
+	conferenceMessagesMu.RLock()
+	newMsg, ok := conferenceMessages[b.MsgType]
+	conferenceMessagesMu.RUnlock()
+	if !ok {
+		return &RawConferenceMessage{Type: b.MsgType, Data: data}, nil
+	}
+
+	msg := newMsg()
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %w", b.MsgType, err)
+	}
+	return msg, nil
+}
+
+// MarshalConferenceMessage encodes msg including its `type` field.
+func MarshalConferenceMessage(msg ConferenceMessage) ([]byte, error) {
+	if raw, ok := msg.(*RawConferenceMessage); ok {
+		return raw.Data, nil
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["type"], _ = json.Marshal(msg.MessageType())
+	return json.Marshal(fields)
+}
+
+// SetConferenceEventHandler forwards typed confserver protocol messages
+// received via data-channel.
+func (cl *Client) SetConferenceEventHandler(handler ConferenceEventHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
+	cl.conferenceEventHandler = handler
+}
@@ -0,0 +1,81 @@
+package ghost
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConferenceMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    ConferenceMessage
+		wantErr bool
+	}{
+		{"ping", `{"type":"ping"}`, &PingMessage{}, false},
+		{"voice activity", `{"type":"voice_activity","cid":"a","on":true}`,
+			&VoiceActivityMessage{ClientID: "a", On: true}, false},
+		{"memberlist", `{"type":"memberlist","count":2,"add":[{"cid":"b","p":"ghost"}],"del":["c"]}`,
+			&MemberListMessage{Count: 2, Added: []Member{{ClientID: "b", Platform: "ghost"}},
+				Deleted: []string{"c"}}, false},
+		{"source update", `{"type":"source_update","l":1,"src":["a"],"dims":[{"x":0,"y":0,"w":640,"h":360}]}`,
+			&SourceUpdateMessage{Layout: 1, Sources: []string{"a"},
+				Dimensions: []Rect{{Width: 640, Height: 360}}}, false},
+		{"unregistered type", `{"type":"chat","content":"hi"}`,
+			&RawConferenceMessage{Type: "chat", Data: []byte(`{"type":"chat","content":"hi"}`)}, false},
+		{"invalid json", `{"type":`, nil, true},
+		{"invalid field", `{"type":"voice_activity","on":"yes"}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConferenceMessage([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalConferenceMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  ConferenceMessage
+		want string
+	}{
+		{"pong", &PongMessage{}, `{"type":"pong"}`},
+		{"mute video", &MuteVideoMessage{ClientID: "a", On: true}, `{"cid":"a","on":true,"type":"mute_video"}`},
+		{"omitted fields", &MemberListMessage{Count: 1}, `{"count":1,"type":"memberlist"}`},
+		{"raw", &RawConferenceMessage{Type: "chat", Data: []byte(`{"type":"chat"}`)}, `{"type":"chat"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalConferenceMessage(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("got %s, want %s", data, tt.want)
+			}
+
+			// the encoded message parses to the original one
+			parsed, err := ParseConferenceMessage(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, tt.msg) {
+				t.Fatalf("got %#v after parsing, want %#v", parsed, tt.msg)
+			}
+		})
+	}
+}
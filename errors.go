@@ -0,0 +1,68 @@
+package ghost
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrCallTimeout is returned by CallContext and TerminateCallContext if
+// the deadline of the passed context is hit.
+var ErrCallTimeout = errors.New("ghost: call deadline exceeded")
+
+// ErrClientDestroyed is returned if the client is destroyed during a call
+// setup.
+var ErrClientDestroyed = errors.New("ghost: client destroyed")
+
+var (
+	// ErrSignalingFailed the request to the signaling server failed.
+	ErrSignalingFailed = errors.New("ghost: signaling failed")
+	// ErrSDPRejected a session description of the conference could not be
+	// applied.
+	ErrSDPRejected = errors.New("ghost: sdp rejected")
+	// ErrCodecNotNegotiated media is written before a codec was agreed on
+	// with the conference, or the conference accepted none of the offered
+	// video codecs.
+	ErrCodecNotNegotiated = errors.New("ghost: codec not negotiated")
+	// ErrICEFailed no ice connection could be established or recovered.
+	ErrICEFailed = errors.New("ghost: ice failed")
+	// ErrTerminatedByServer the call was ended by the conference.
+	ErrTerminatedByServer = errors.New("ghost: terminated by server")
+	// ErrSetupFailed the media engine, transport or peer connection could
+	// not be created.
+	ErrSetupFailed = errors.New("ghost: setup failed")
+	// ErrCallAborted the context ended before a step completed. The cause
+	// is ErrCallTimeout or context.Canceled.
+	ErrCallAborted = errors.New("ghost: call aborted")
+)
+
+// CallError describes a failed step of a call. It matches its Kind, one
+// of the Err* values, with errors.Is and unwraps to the cause, e.g.
+// ErrCallTimeout.
+type CallError struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *CallError) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error() + ": " + e.Op
+	}
+	return e.Kind.Error() + ": " + e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause.
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of the error.
+func (e *CallError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// signalingError classifies a failed signaling request. Timeouts are
+// reported as ErrCallTimeout cause.
+func signalingError(ctx context.Context, op string, err error) error {
+	return &CallError{Kind: ErrSignalingFailed, Op: op, Err: contextError(ctx, err)}
+}
@@ -0,0 +1,177 @@
+package ghost
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType type of an Event.
+type EventType int
+
+const (
+	// EventConnected the call is connected, the local tracks are set.
+	EventConnected EventType = iota + 1
+	// EventTrackAdded a remote track was received, see Track.
+	EventTrackAdded
+	// EventDataChannelMessage a data-channel message was received, see Data.
+	EventDataChannelMessage
+	// EventConferenceMessage a conference protocol message was received,
+	// see Message.
+	EventConferenceMessage
+	// EventStats periodic call statistics, see Stats.
+	EventStats
+	// EventError a failure which does not end the call, see Err.
+	EventError
+	// EventTerminated the call ended. No further events follow except for
+	// late errors. Err is ErrTerminatedByServer or a CallError matching
+	// ErrICEFailed unless the client ended the call.
+	EventTerminated
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventTrackAdded:
+		return "track-added"
+	case EventDataChannelMessage:
+		return "data-channel-message"
+	case EventConferenceMessage:
+		return "conference-message"
+	case EventStats:
+		return "stats"
+	case EventError:
+		return "error"
+	case EventTerminated:
+		return "terminated"
+	}
+	return "unknown"
+}
+
+// Event notification of the client. Only the fields of the event type are
+// set.
+type Event struct {
+	Type       EventType
+	VideoTrack RTPWriter
+	AudioTrack RTPWriter
+	Track      *RemoteTrack
+	Data       []byte
+	Message    ConferenceMessage
+	Stats      CallStats
+	Err        error
+}
+
+// WithStatsEventInterval sends an EventStats at the given interval via the
+// Events channel.
+func WithStatsEventInterval(interval time.Duration) ClientOption {
+	return func(h *Client) {
+		h.statsEventInterval = interval
+	}
+}
+
+// Events returns a channel of all notifications as an alternative to the
+// Set*Handler callbacks, which are still called. Events are delivered in
+// the order they occurred. They are queued without limit, so the internal
+// goroutines are never blocked, and the channel has to be read until it is
+// closed after Destroy. Only events occurring after the first call of
+// Events are delivered.
+func (cl *Client) Events() <-chan Event {
+	cl.eventsMu.Lock()
+	defer cl.eventsMu.Unlock()
+	if cl.events == nil {
+		cl.events = &eventQueue{
+			notify: make(chan struct{}, 1),
+			ch:     make(chan Event),
+		}
+		go cl.events.run(cl.closeCh)
+		if cl.statsEventInterval > 0 {
+			interval := cl.statsEventInterval
+			cl.startRoutine(func() { cl.sendStatsEvents(interval) })
+		}
+	}
+	return cl.events.ch
+}
+
+// emit queues an event if Events is used.
+func (cl *Client) emit(event Event) {
+	cl.eventsMu.Lock()
+	queue := cl.events
+	cl.eventsMu.Unlock()
+	if queue != nil {
+		queue.push(event)
+	}
+}
+
+func (cl *Client) emitError(err error) {
+	cl.emit(Event{Type: EventError, Err: err})
+}
+
+func (cl *Client) sendStatsEvents(interval time.Duration) {
+	samples := bitrateSamples{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cl.emit(Event{Type: EventStats, Stats: cl.collectStats(samples)})
+		case <-cl.closeCh:
+			return
+		}
+	}
+}
+
+// eventQueue is an unbounded queue feeding the events channel.
+type eventQueue struct {
+	mu     sync.Mutex
+	events []Event
+	closed bool
+	notify chan struct{}
+	ch     chan Event
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the queued events. After closeCh is closed the remaining
+// events are delivered and the channel is closed.
+func (q *eventQueue) run(closeCh chan struct{}) {
+	for {
+		q.mu.Lock()
+		if len(q.events) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.notify:
+				continue
+			case <-closeCh:
+			}
+
+			q.mu.Lock()
+			q.closed = true
+			remaining := q.events
+			q.events = nil
+			q.mu.Unlock()
+			for _, event := range remaining {
+				q.ch <- event
+			}
+			close(q.ch)
+			return
+		}
+		event := q.events[0]
+		q.events = q.events[1:]
+		q.mu.Unlock()
+
+		q.ch <- event
+	}
+}
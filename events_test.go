@@ -0,0 +1,36 @@
+package ghost
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTerminatedEventWithDestroyingHandler(t *testing.T) {
+	cl := newClient(testCallInfo{})
+	events := cl.Events()
+	// the documented way to shut down, the events channel is closed
+	// meanwhile
+	cl.SetTerminatedHandler(func() {
+		cl.Destroy()
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	cl.notifyTerminated(ErrTerminatedByServer)
+
+	var got []Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if len(got) != 1 || got[0].Type != EventTerminated || got[0].Err != ErrTerminatedByServer {
+					t.Fatalf("got events %v, want terminated by server", got)
+				}
+				return
+			}
+			got = append(got, event)
+		case <-timeout:
+			t.Fatal("events channel not closed")
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package ghost
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/rtp/codecs/av1/frame"
+	"github.com/pion/rtp/codecs/av1/obu"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/samplebuilder"
+)
+
+const (
+	defaultJitterBufferLatency = 200 * time.Millisecond
+	// minimum time between two keyframe requests after frame loss
+	lossKeyframeRequestInterval = time.Second
+	videoMaxLatePackets         = 512
+	audioMaxLatePackets         = 64
+)
+
+// Frame is a complete media frame assembled from rtp packets. Video frames
+// of H264 and H265 are in Annex-B format, AV1 frames are a sequence of OBUs
+// with size fields.
+type Frame struct {
+	Data []byte
+	// PTS presentation timestamp relative to the first frame of the track.
+	PTS          time.Duration
+	Duration     time.Duration
+	RTPTimestamp uint32
+	Keyframe     bool
+	MimeType     string
+	// PacketsLost number of packets lost right before this frame.
+	PacketsLost int
+}
+
+// FrameHandler called for each assembled frame.
+type FrameHandler func(frame *Frame)
+
+// WithJitterBufferLatency sets the maximum time packets are held back for
+// reordering before frames are assembled. Defaults to 200ms. Only used
+// with SetVideoFrameHandler and SetAudioFrameHandler.
+func WithJitterBufferLatency(latency time.Duration) ClientOption {
+	return func(h *Client) {
+		h.jitterBufferLatency = latency
+	}
+}
+
+// SetVideoFrameHandler forwards reordered and depacketized video frames.
+// A keyframe is requested if a frame is lost.
+func (cl *Client) SetVideoFrameHandler(handler FrameHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
+	cl.videoFrameHandler = handler
+}
+
+// SetAudioFrameHandler forwards reordered and depacketized audio frames.
+func (cl *Client) SetAudioFrameHandler(handler FrameHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
+	cl.audioFrameHandler = handler
+}
+
+// frameAssembler reorders the packets of a remote track and assembles
+// them into frames.
+type frameAssembler struct {
+	builder         *samplebuilder.SampleBuilder
+	mimeType        string
+	clockRate       uint32
+	started         bool
+	lastTimestamp   uint32
+	unwrapped       int64
+	requestKeyframe func()
+	lastRequest     time.Time
+}
+
+// newFrameAssembler returns nil if the codec is not supported.
+func newFrameAssembler(codec webrtc.RTPCodecParameters, latency time.Duration,
+	requestKeyframe func()) *frameAssembler {
+	var depacketizer rtp.Depacketizer
+	var maxLate uint16 = videoMaxLatePackets
+	mimeType := strings.ToLower(codec.MimeType)
+	switch mimeType {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		depacketizer = &codecs.VP8Packet{}
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		depacketizer = &codecs.VP9Packet{}
+	case strings.ToLower(webrtc.MimeTypeH264):
+		depacketizer = &codecs.H264Packet{}
+	case strings.ToLower(webrtc.MimeTypeH265):
+		depacketizer = &h265Depacketizer{}
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		depacketizer = &av1Depacketizer{}
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		depacketizer = &codecs.OpusPacket{}
+		maxLate = audioMaxLatePackets
+	default:
+		return nil
+	}
+	if latency <= 0 {
+		latency = defaultJitterBufferLatency
+	}
+
+	fa := &frameAssembler{
+		mimeType:        codec.MimeType,
+		clockRate:       codec.ClockRate,
+		requestKeyframe: requestKeyframe,
+	}
+	fa.builder = samplebuilder.New(maxLate, depacketizer, codec.ClockRate,
+		samplebuilder.WithMaxTimeDelay(latency),
+		samplebuilder.WithPacketHeadHandler(isKeyframeHead))
+	return fa
+}
+
+// push adds a packet and returns the frames completed by it.
+func (fa *frameAssembler) push(p *rtp.Packet) []*Frame {
+	fa.builder.Push(p)
+
+	var frames []*Frame
+	for {
+		sample := fa.builder.Pop()
+		if sample == nil {
+			return frames
+		}
+
+		if !fa.started {
+			fa.started = true
+			fa.lastTimestamp = sample.PacketTimestamp
+		}
+		fa.unwrapped += int64(int32(sample.PacketTimestamp - fa.lastTimestamp))
+		fa.lastTimestamp = sample.PacketTimestamp
+
+		f := &Frame{
+			Data:         sample.Data,
+			PTS:          time.Duration(fa.unwrapped) * time.Second / time.Duration(fa.clockRate),
+			Duration:     sample.Duration,
+			RTPTimestamp: sample.PacketTimestamp,
+			MimeType:     fa.mimeType,
+			PacketsLost:  int(sample.PrevDroppedPackets),
+		}
+		switch keyframe := sample.Metadata.(type) {
+		case bool:
+			f.Keyframe = keyframe
+		default:
+			f.Keyframe = annexBHasKeyframe(fa.mimeType, sample.Data)
+		}
+
+		if f.PacketsLost > 0 && !f.Keyframe && fa.requestKeyframe != nil &&
+			time.Since(fa.lastRequest) >= lossKeyframeRequestInterval {
+			fa.lastRequest = time.Now()
+			fa.requestKeyframe()
+		}
+		frames = append(frames, f)
+	}
+}
+
+// isKeyframeHead inspects the depacketizer after the first packet of a
+// frame has been unmarshaled. Returns nil if the keyframe flag has to be
+// taken from the frame data.
+func isKeyframeHead(headPacket interface{}) interface{} {
+	switch p := headPacket.(type) {
+	case *codecs.VP8Packet:
+		return len(p.Payload) > 0 && p.Payload[0]&0x01 == 0
+	case *codecs.VP9Packet:
+		return !p.P
+	case *av1Depacketizer:
+		return p.newSequence
+	case *codecs.OpusPacket:
+		return true
+	}
+	return nil
+}
+
+// annexBHasKeyframe scans an Annex-B H264 or H265 frame for IDR/IRAP
+// nal units.
+func annexBHasKeyframe(mimeType string, data []byte) bool {
+	h265 := strings.EqualFold(mimeType, webrtc.MimeTypeH265)
+	zeros := 0
+	for i, b := range data {
+		if b == 0 {
+			zeros++
+			continue
+		}
+		if b == 1 && zeros >= 2 && i+1 < len(data) {
+			if h265 {
+				naluType := (data[i+1] >> 1) & 0x3F
+				if naluType >= 16 && naluType <= 21 {
+					return true
+				}
+			} else if data[i+1]&0x1F == 5 {
+				return true
+			}
+		}
+		zeros = 0
+	}
+	return false
+}
+
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// h265Depacketizer converts H265 rtp payloads (RFC 7798) to Annex-B.
+type h265Depacketizer struct {
+	codecs.H265Packet
+}
+
+// Unmarshal implements rtp.Depacketizer
+func (d *h265Depacketizer) Unmarshal(payload []byte) ([]byte, error) {
+	if len(payload) < 3 {
+		return nil, nil
+	}
+	switch naluType := (payload[0] >> 1) & 0x3F; naluType {
+	case 48: // aggregation packet
+		var out []byte
+		for idx := 2; idx+2 <= len(payload); {
+			size := int(payload[idx])<<8 | int(payload[idx+1])
+			idx += 2
+			if idx+size > len(payload) {
+				break
+			}
+			out = append(out, annexBStartCode...)
+			out = append(out, payload[idx:idx+size]...)
+			idx += size
+		}
+		return out, nil
+	case 49: // fragmentation unit
+		fuHeader := payload[2]
+		if fuHeader&0x80 == 0 {
+			return payload[3:], nil
+		}
+		// restore the nal unit header
+		out := append([]byte{}, annexBStartCode...)
+		out = append(out, (payload[0]&0x81)|(fuHeader&0x3F)<<1, payload[1])
+		return append(out, payload[3:]...), nil
+	case 50: // PACI
+		return nil, nil
+	}
+	return append(append([]byte{}, annexBStartCode...), payload...), nil
+}
+
+// av1Depacketizer converts AV1 rtp payloads to OBUs with size fields.
+// Fragmented OBUs are buffered until complete.
+type av1Depacketizer struct {
+	frame       frame.AV1
+	newSequence bool
+}
+
+// Unmarshal implements rtp.Depacketizer
+func (d *av1Depacketizer) Unmarshal(payload []byte) ([]byte, error) {
+	packet := codecs.AV1Packet{}
+	if _, err := packet.Unmarshal(payload); err != nil {
+		return nil, err
+	}
+	d.newSequence = packet.N
+
+	obus, err := d.frame.ReadFrames(&packet)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, o := range obus {
+		out = append(out, withOBUSize(o)...)
+	}
+	return out, nil
+}
+
+// IsPartitionHead implements rtp.Depacketizer. A frame starts with a
+// packet which does not continue an OBU fragment.
+func (d *av1Depacketizer) IsPartitionHead(payload []byte) bool {
+	return len(payload) > 0 && payload[0]&0x80 == 0
+}
+
+// IsPartitionTail implements rtp.Depacketizer
+func (d *av1Depacketizer) IsPartitionTail(marker bool, _ []byte) bool {
+	return marker
+}
+
+// withOBUSize adds the obu_size field to an OBU if missing.
+func withOBUSize(o []byte) []byte {
+	if len(o) == 0 || o[0]&0x02 != 0 {
+		return o
+	}
+	headerSize := 1
+	if o[0]&0x04 != 0 {
+		headerSize = 2
+	}
+	if len(o) < headerSize {
+		return o
+	}
+	out := make([]byte, 0, len(o)+8)
+	out = append(out, o[0]|0x02)
+	out = append(out, o[1:headerSize]...)
+	out = append(out, obu.WriteToLeb128(uint(len(o)-headerSize))...)
+	return append(out, o[headerSize:]...)
+}
@@ -0,0 +1,119 @@
+package ghost
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestH265Depacketizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []byte
+	}{
+		{"single nal unit", []byte{0x26, 0x01, 0xaa, 0xbb},
+			[]byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaa, 0xbb}},
+		{"aggregation packet", []byte{0x60, 0x01, 0x00, 0x03, 0x40, 0x01, 0xaa, 0x00, 0x02, 0x42, 0x01},
+			[]byte{0x00, 0x00, 0x00, 0x01, 0x40, 0x01, 0xaa, 0x00, 0x00, 0x00, 0x01, 0x42, 0x01}},
+		{"truncated aggregation packet", []byte{0x60, 0x01, 0x00, 0x02, 0x40, 0x01, 0x00, 0x05, 0x42},
+			[]byte{0x00, 0x00, 0x00, 0x01, 0x40, 0x01}},
+		{"fragment start", []byte{0x62, 0x01, 0x93, 0xaa, 0xbb},
+			[]byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaa, 0xbb}},
+		{"fragment continuation", []byte{0x62, 0x01, 0x13, 0xcc, 0xdd}, []byte{0xcc, 0xdd}},
+		{"paci", []byte{0x64, 0x01, 0x00, 0x00}, nil},
+		{"too short", []byte{0x26, 0x01}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&h265Depacketizer{}).Unmarshal(tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAV1Depacketizer(t *testing.T) {
+	tests := []struct {
+		name        string
+		payloads    [][]byte
+		want        []byte
+		newSequence bool
+	}{
+		{
+			name:     "single obu",
+			payloads: [][]byte{{0x10, 0x30, 0xaa, 0xbb}},
+			want:     []byte{0x32, 0x02, 0xaa, 0xbb},
+		},
+		{
+			name:        "new coded video sequence",
+			payloads:    [][]byte{{0x18, 0x08, 0x01}},
+			want:        []byte{0x0a, 0x01, 0x01},
+			newSequence: true,
+		},
+		{
+			name:     "two obus",
+			payloads: [][]byte{{0x20, 0x02, 0x08, 0x01, 0x30, 0xaa}},
+			want:     []byte{0x0a, 0x01, 0x01, 0x32, 0x01, 0xaa},
+		},
+		{
+			name:     "fragmented obu",
+			payloads: [][]byte{{0x50, 0x30, 0xaa}, {0x90, 0xbb, 0xcc}},
+			want:     []byte{0x32, 0x03, 0xaa, 0xbb, 0xcc},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &av1Depacketizer{}
+			var got []byte
+			for _, payload := range tt.payloads {
+				out, err := d.Unmarshal(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, out...)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %x, want %x", got, tt.want)
+			}
+			if d.newSequence != tt.newSequence {
+				t.Fatalf("got new sequence %v, want %v", d.newSequence, tt.newSequence)
+			}
+		})
+	}
+}
+
+func TestAnnexBHasKeyframe(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		data     []byte
+		want     bool
+	}{
+		{"h264 idr", webrtc.MimeTypeH264, []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88}, true},
+		{"h264 idr after sps", webrtc.MimeTypeH264,
+			[]byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x00, 0x01, 0x65, 0x88}, true},
+		{"h264 non-idr", webrtc.MimeTypeH264, []byte{0x00, 0x00, 0x01, 0x41, 0x9a}, false},
+		{"h264 without start code", webrtc.MimeTypeH264, []byte{0x65, 0x88}, false},
+		{"h265 idr", webrtc.MimeTypeH265, []byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01}, true},
+		{"h265 cra", webrtc.MimeTypeH265, []byte{0x00, 0x00, 0x01, 0x2a, 0x01}, true},
+		{"h265 trail", webrtc.MimeTypeH265, []byte{0x00, 0x00, 0x01, 0x02, 0x01}, false},
+		{"h265 vps only", webrtc.MimeTypeH265, []byte{0x00, 0x00, 0x01, 0x40, 0x01}, false},
+		{"start code at the end", webrtc.MimeTypeH264, []byte{0x41, 0x00, 0x00, 0x01}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := annexBHasKeyframe(tt.mimeType, tt.data); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
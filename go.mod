@@ -8,10 +8,11 @@ require (
 	github.com/gorilla/websocket v1.5.1 // indirect
 	github.com/pion/datachannel v1.5.6 // indirect
 	github.com/pion/dtls/v2 v2.2.10 // indirect
-	github.com/pion/ice/v2 v2.3.14 // indirect
+	github.com/pion/ice/v2 v2.3.14
 	github.com/pion/interceptor v0.1.27
 	github.com/pion/rtcp v1.2.14
 	github.com/pion/rtp v1.8.5
+	github.com/pion/sdp/v3 v3.0.9
 	github.com/pion/sctp v1.8.15 // indirect
 	github.com/pion/turn/v2 v2.1.5 // indirect
 	github.com/pion/webrtc/v3 v3.2.34
@@ -0,0 +1,30 @@
+package ghost
+
+import (
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v3"
+)
+
+// InterceptorConfigurer registers custom interceptors, codecs or header
+// extensions.
+type InterceptorConfigurer func(registry *interceptor.Registry, m *webrtc.MediaEngine) error
+
+// WithInterceptors adds custom interceptors to the peer connection. The
+// configurer is called after the built-in interceptors are registered,
+// for every peer connection created, including call recoveries.
+func WithInterceptors(configure InterceptorConfigurer) ClientOption {
+	return func(h *Client) {
+		h.interceptorConfigurers = append(h.interceptorConfigurers, configure)
+	}
+}
+
+// configureInterceptors calls the custom interceptor configurers.
+func (cl *Client) configureInterceptors(m *webrtc.MediaEngine,
+	interceptReg *interceptor.Registry) error {
+	for _, configure := range cl.interceptorConfigurers {
+		if err := configure(interceptReg, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package ghost
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// minimum time between two resends of the cached keyframe
+const keyframeResendInterval = 500 * time.Millisecond
+
+// KeyframeRequestHandler called when the remote peer requests a keyframe
+// (PLI or FIR) for the local video track.
+type KeyframeRequestHandler func()
+
+// SetKeyframeRequestHandler forwards keyframe requests for the local video
+// track, so the source can produce a new keyframe.
+func (cl *Client) SetKeyframeRequestHandler(handler KeyframeRequestHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
+	cl.keyframeRequestHandler = handler
+}
+
+// WithKeyframeCache wraps the local video track handed out via the
+// ConnectedHandler with a KeyframeCache. The cached keyframe is resent
+// whenever the remote peer requests one. Useful for passthrough sources
+// which cannot produce keyframes on demand.
+func WithKeyframeCache() ClientOption {
+	return func(h *Client) {
+		h.useKeyframeCache = true
+	}
+}
+
+func (cl *Client) onKeyframeRequest() {
+	if cl.keyframeCache != nil {
+		if err := cl.keyframeCache.ResendKeyframe(); err != nil {
+			cl.logger.Debug("Failed to resend keyframe: %s", err)
+		}
+	}
+	cl.handlerMu.RLock()
+	handler := cl.keyframeRequestHandler
+	cl.handlerMu.RUnlock()
+	if handler != nil {
+		handler()
+	}
+}
+
+// KeyframeCache is a RTPWriter keeping the packets of the last keyframe
+// written, so they can be sent again on request. Sequence numbers of all
+// packets are rewritten to stay continuous.
+type KeyframeCache struct {
+	writer        RTPWriter
+	mimeType      func() string
+	mu            sync.Mutex
+	packets       []*rtp.Packet
+	caching       bool
+	started       bool
+	pending       bool
+	seqOffset     uint16
+	lastSeq       uint16
+	lastTs        uint32
+	frameInterval uint32
+	lastSent      time.Time
+}
+
+// NewKeyframeCache creates a KeyframeCache writing to writer. mimeType
+// is the video codec of the packets, e.g. webrtc.MimeTypeH264.
+func NewKeyframeCache(writer RTPWriter, mimeType string) *KeyframeCache {
+	return &KeyframeCache{writer: writer, mimeType: func() string { return mimeType }}
+}
+
+// MimeType implements CodecWriter
+func (kc *KeyframeCache) MimeType() string {
+	return kc.mimeType()
+}
+
+// WriteRTP implements RTPWriter. A requested keyframe is sent between
+// two frames, after the packet with the marker bit or before the first
+// packet of the next frame.
+func (kc *KeyframeCache) WriteRTP(p *rtp.Packet) error {
+	kc.mu.Lock()
+	keyframeStart := IsKeyframeStart(kc.mimeType(), p.Payload)
+	newFrame := kc.started && p.Timestamp != kc.lastTs
+
+	var before, after []*rtp.Packet
+	if keyframeStart {
+		// a new keyframe is on its way anyway
+		kc.pending = false
+	}
+	if kc.pending && newFrame {
+		// the previous frame ended without marker bit
+		before = kc.keyframePackets(kc.lastTs + halfInterval(p.Timestamp-kc.lastTs))
+	}
+	if newFrame {
+		kc.frameInterval = p.Timestamp - kc.lastTs
+	}
+
+	switch {
+	case keyframeStart && (!kc.caching || p.Timestamp != kc.packets[0].Timestamp):
+		kc.packets = []*rtp.Packet{p.Clone()}
+		kc.caching = true
+	case kc.caching && p.Timestamp == kc.packets[0].Timestamp:
+		kc.packets = append(kc.packets, p.Clone())
+	default:
+		kc.caching = false
+	}
+
+	// keep the sequence numbers continuous after a resend before p
+	out := *p
+	out.SequenceNumber = p.SequenceNumber + kc.seqOffset
+	kc.lastSeq = out.SequenceNumber
+	kc.lastTs = p.Timestamp
+	kc.started = true
+
+	if kc.pending && p.Marker {
+		after = kc.keyframePackets(p.Timestamp + halfInterval(kc.frameInterval))
+	}
+	kc.mu.Unlock()
+
+	for _, resent := range before {
+		if err := kc.writer.WriteRTP(resent); err != nil {
+			return err
+		}
+	}
+	if err := kc.writer.WriteRTP(&out); err != nil {
+		return err
+	}
+	for _, resent := range after {
+		if err := kc.writer.WriteRTP(resent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResendKeyframe sends the cached keyframe again once the frame currently
+// written is complete. It gets new sequence numbers and a timestamp
+// between the current and the next frame. Requests within 500ms after the
+// last one are ignored.
+func (kc *KeyframeCache) ResendKeyframe() error {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if !kc.started || len(kc.packets) == 0 || time.Since(kc.lastSent) < keyframeResendInterval {
+		return nil
+	}
+	kc.lastSent = time.Now()
+	kc.pending = true
+	return nil
+}
+
+// keyframePackets returns a copy of the cached keyframe with timestamp ts
+// and the next sequence numbers. Must be called with mu held.
+func (kc *KeyframeCache) keyframePackets(ts uint32) []*rtp.Packet {
+	kc.pending = false
+	packets := make([]*rtp.Packet, 0, len(kc.packets))
+	for _, cached := range kc.packets {
+		p := *cached
+		kc.lastSeq++
+		kc.seqOffset++
+		p.SequenceNumber = kc.lastSeq
+		p.Timestamp = ts
+		packets = append(packets, &p)
+	}
+	return packets
+}
+
+// halfInterval returns the timestamp offset in the middle of a frame
+// interval, at least 1.
+func halfInterval(interval uint32) uint32 {
+	if interval < 2 {
+		return 1
+	}
+	return interval / 2
+}
+
+// IsKeyframeStart reports whether payload is the first packet of a
+// keyframe (including parameter sets) of the given video codec.
+func IsKeyframeStart(mimeType string, payload []byte) bool {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return isVP8KeyframeStart(payload)
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return isVP9KeyframeStart(payload)
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return isH264KeyframeStart(payload)
+	case strings.ToLower(webrtc.MimeTypeH265):
+		return isH265KeyframeStart(payload)
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		return isAV1KeyframeStart(payload)
+	}
+	return false
+}
+
+func isVP8KeyframeStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	// start of partition 0
+	if payload[0]&0x10 == 0 || payload[0]&0x07 != 0 {
+		return false
+	}
+	idx := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		ext := payload[1]
+		idx++
+		if ext&0x80 != 0 {
+			// picture id, 7 or 15 bit
+			if len(payload) <= idx {
+				return false
+			}
+			if payload[idx]&0x80 != 0 {
+				idx++
+			}
+			idx++
+		}
+		if ext&0x40 != 0 {
+			idx++
+		}
+		if ext&0x30 != 0 {
+			idx++
+		}
+	}
+	if len(payload) <= idx {
+		return false
+	}
+	// inverse keyframe flag of the vp8 frame header
+	return payload[idx]&0x01 == 0
+}
+
+func isVP9KeyframeStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	// start of frame and not inter-picture predicted
+	return payload[0]&0x08 != 0 && payload[0]&0x40 == 0
+}
+
+func isH264KeyframeStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	isKey := func(naluType byte) bool {
+		return naluType == 5 || naluType == 7
+	}
+	naluType := payload[0] & 0x1F
+	switch naluType {
+	case 24: // STAP-A
+		for idx := 1; idx+2 < len(payload); {
+			size := int(payload[idx])<<8 | int(payload[idx+1])
+			if isKey(payload[idx+2] & 0x1F) {
+				return true
+			}
+			idx += 2 + size
+		}
+		return false
+	case 28: // FU-A
+		return len(payload) > 1 && payload[1]&0x80 != 0 && isKey(payload[1]&0x1F)
+	}
+	return isKey(naluType)
+}
+
+func isH265KeyframeStart(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	isKey := func(naluType byte) bool {
+		// IRAP pictures and parameter sets
+		return (naluType >= 16 && naluType <= 21) || (naluType >= 32 && naluType <= 34)
+	}
+	naluType := (payload[0] >> 1) & 0x3F
+	switch naluType {
+	case 48: // aggregation packet
+		for idx := 2; idx+2 < len(payload); {
+			size := int(payload[idx])<<8 | int(payload[idx+1])
+			if isKey((payload[idx+2] >> 1) & 0x3F) {
+				return true
+			}
+			idx += 2 + size
+		}
+		return false
+	case 49: // fragmentation unit
+		return len(payload) > 2 && payload[2]&0x80 != 0 && isKey(payload[2]&0x3F)
+	}
+	return isKey(naluType)
+}
+
+func isAV1KeyframeStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	// first packet of a coded video sequence
+	return payload[0]&0x08 != 0
+}
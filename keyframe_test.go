@@ -0,0 +1,153 @@
+package ghost
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestIsKeyframeStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		payload  []byte
+		want     bool
+	}{
+		{"vp8 keyframe", webrtc.MimeTypeVP8, []byte{0x10, 0x00}, true},
+		{"vp8 lower case mime type", "video/vp8", []byte{0x10, 0x00}, true},
+		{"vp8 inter frame", webrtc.MimeTypeVP8, []byte{0x10, 0x01}, false},
+		{"vp8 continuation", webrtc.MimeTypeVP8, []byte{0x00, 0x00}, false},
+		{"vp8 15 bit picture id", webrtc.MimeTypeVP8, []byte{0x90, 0x80, 0x81, 0x23, 0x00}, true},
+		{"vp8 7 bit picture id", webrtc.MimeTypeVP8, []byte{0x90, 0x80, 0x01, 0x01}, false},
+		{"vp8 truncated", webrtc.MimeTypeVP8, []byte{0x90, 0x80}, false},
+		{"vp9 keyframe", webrtc.MimeTypeVP9, []byte{0x08}, true},
+		{"vp9 inter frame", webrtc.MimeTypeVP9, []byte{0x48}, false},
+		{"h264 idr", webrtc.MimeTypeH264, []byte{0x65, 0x88}, true},
+		{"h264 sps", webrtc.MimeTypeH264, []byte{0x67, 0x42}, true},
+		{"h264 non-idr", webrtc.MimeTypeH264, []byte{0x41, 0x9a}, false},
+		{"h264 stap-a with sps", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x01, 0x09, 0x00, 0x02, 0x67, 0x42}, true},
+		{"h264 stap-a without keyframe", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x02, 0x41, 0x9a}, false},
+		{"h264 fu-a start of idr", webrtc.MimeTypeH264, []byte{0x7c, 0x85, 0x88}, true},
+		{"h264 fu-a continuation of idr", webrtc.MimeTypeH264, []byte{0x7c, 0x05, 0x88}, false},
+		{"h265 idr", webrtc.MimeTypeH265, []byte{0x26, 0x01}, true},
+		{"h265 vps", webrtc.MimeTypeH265, []byte{0x40, 0x01}, true},
+		{"h265 trail", webrtc.MimeTypeH265, []byte{0x02, 0x01}, false},
+		{"h265 aggregation with vps", webrtc.MimeTypeH265, []byte{0x60, 0x01, 0x00, 0x02, 0x40, 0x01}, true},
+		{"h265 fragment start of idr", webrtc.MimeTypeH265, []byte{0x62, 0x01, 0x93}, true},
+		{"h265 fragment continuation of idr", webrtc.MimeTypeH265, []byte{0x62, 0x01, 0x13}, false},
+		{"h265 truncated", webrtc.MimeTypeH265, []byte{0x26}, false},
+		{"av1 new sequence", webrtc.MimeTypeAV1, []byte{0x08}, true},
+		{"av1 frame", webrtc.MimeTypeAV1, []byte{0x10}, false},
+		{"empty payload", webrtc.MimeTypeH264, nil, false},
+		{"audio", webrtc.MimeTypeOpus, []byte{0x65}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsKeyframeStart(tt.mimeType, tt.payload); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// rtpRecorder records the packets written.
+type rtpRecorder struct {
+	packets []*rtp.Packet
+}
+
+func (r *rtpRecorder) WriteRTP(p *rtp.Packet) error {
+	r.packets = append(r.packets, p.Clone())
+	return nil
+}
+
+func TestKeyframeCacheWriteRTP(t *testing.T) {
+	keyframe := []byte{0x10, 0x00}
+	interFrame := []byte{0x10, 0x01}
+	continuation := []byte{0x00, 0x01}
+
+	type write struct {
+		ts      uint32
+		marker  bool
+		payload []byte
+	}
+	type sent struct {
+		seq uint16
+		ts  uint32
+	}
+	tests := []struct {
+		name string
+		// the keyframe is requested before writes[resendBefore]
+		writes       []write
+		resendBefore int
+		want         []sent
+	}{
+		{
+			name: "between frames",
+			writes: []write{
+				{0, false, keyframe}, {0, true, continuation},
+				{3000, true, interFrame}, {6000, true, interFrame},
+			},
+			resendBefore: 2,
+			want:         []sent{{100, 0}, {101, 0}, {102, 1500}, {103, 1500}, {104, 3000}, {105, 6000}},
+		},
+		{
+			name: "after marker",
+			writes: []write{
+				{0, true, keyframe}, {3000, false, interFrame},
+				{3000, true, continuation}, {6000, true, interFrame},
+			},
+			resendBefore: 2,
+			want:         []sent{{100, 0}, {101, 3000}, {102, 3000}, {103, 4500}, {104, 6000}},
+		},
+		{
+			name: "without marker",
+			writes: []write{
+				{0, true, keyframe}, {3000, false, interFrame},
+				{6000, false, interFrame},
+			},
+			resendBefore: 2,
+			want:         []sent{{100, 0}, {101, 3000}, {102, 4500}, {103, 6000}},
+		},
+		{
+			name: "superseded by a new keyframe",
+			writes: []write{
+				{0, true, keyframe}, {3000, true, keyframe},
+			},
+			resendBefore: 1,
+			want:         []sent{{100, 0}, {101, 3000}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &rtpRecorder{}
+			cache := NewKeyframeCache(recorder, webrtc.MimeTypeVP8)
+			for i, w := range tt.writes {
+				if i == tt.resendBefore {
+					if err := cache.ResendKeyframe(); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := cache.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{Version: 2, SequenceNumber: uint16(100 + i),
+						Timestamp: w.ts, Marker: w.marker},
+					Payload: w.payload,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(recorder.packets) != len(tt.want) {
+				t.Fatalf("got %d packets, want %d", len(recorder.packets), len(tt.want))
+			}
+			for i, p := range recorder.packets {
+				if p.SequenceNumber != tt.want[i].seq || p.Timestamp != tt.want[i].ts {
+					t.Fatalf("packet %d: got seq %d ts %d, want seq %d ts %d", i,
+						p.SequenceNumber, p.Timestamp, tt.want[i].seq, tt.want[i].ts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package ghost
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ErrDataChannelNotOpen is returned when sending via a data-channel which
+// is not open yet.
+var ErrDataChannelNotOpen = errors.New("ghost: data-channel not open")
+
+// WithNoSEPPMessaging configures that messages are always sent via
+// data-channel, even if the signaling connection is able to send them.
+func WithNoSEPPMessaging() ClientOption {
+	return func(h *Client) {
+		h.sendMessagesViaSEPP = false
+	}
+}
+
+// SendDataChannelMessage sends data via the data-channel.
+// ErrDataChannelNotOpen is returned if the channel is not open yet.
+func (cl *Client) SendDataChannelMessage(data []byte) error {
+	dataChannel := cl.activeDataChannel()
+	if dataChannel == nil || dataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+		return ErrDataChannelNotOpen
+	}
+	return dataChannel.Send(data)
+}
+
+// SendMessage sends a confserver message via the signaling connection if
+// SEPP-messaging is used, see WithNoSEPPMessaging, and via the
+// data-channel otherwise. ErrDataChannelNotOpen is returned if the channel
+// is not open yet.
+func (cl *Client) SendMessage(msg ConferenceMessage) error {
+	data, err := MarshalConferenceMessage(msg)
+	if err != nil {
+		return err
+	}
+	if cl.seppMessaging() {
+		ctx := context.Background()
+		if err := cl.activeCall().SendMessage(ctx, data); err != nil {
+			return signalingError(ctx, "send message", err)
+		}
+		return nil
+	}
+	return cl.SendDataChannelMessage(data)
+}
+
+// seppMessaging reports whether messages are sent via the signaling
+// connection. This is announced to the conference with the offer.
+func (cl *Client) seppMessaging() bool {
+	if !cl.sendMessagesViaSEPP || !cl.useConfProtocol {
+		return false
+	}
+	call := cl.activeCall()
+	return call != nil && call.Messaging()
+}
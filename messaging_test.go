@@ -0,0 +1,46 @@
+package ghost
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendMessageRouting(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []ClientOption
+		messaging bool
+		viaSEPP   bool
+	}{
+		{"sepp messaging", nil, true, true},
+		{"signaling without messaging", nil, false, false},
+		{"no sepp messaging", []ClientOption{WithNoSEPPMessaging()}, true, false},
+		{"no conf protocol", []ClientOption{WithNoConfProtocol()}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newClient(testCallInfo{}, tt.opts...)
+			call := &testCall{messaging: tt.messaging}
+			cl.call = call
+
+			err := cl.SendMessage(&PongMessage{})
+			if tt.viaSEPP {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(call.messages) != 1 {
+					t.Fatalf("got %d messages via signaling, want 1", len(call.messages))
+				}
+				return
+			}
+			// no peer connection, so the data-channel is not open
+			if !errors.Is(err, ErrDataChannelNotOpen) {
+				t.Fatalf("got error %v, want %v", err, ErrDataChannelNotOpen)
+			}
+			if len(call.messages) != 0 {
+				t.Fatalf("got %d messages via signaling, want 0", len(call.messages))
+			}
+		})
+	}
+}
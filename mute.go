@@ -0,0 +1,45 @@
+package ghost
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// SetVideoMuted pauses or resumes the local video track. Packets written
+// while muted are dropped. The video transceiver is switched to recvonly,
+// or inactive if sending only, and a running call is renegotiated, so the
+// conference doesn't show a frozen frame. On unmute a keyframe is
+// requested from the source. The mute is undone if the renegotiation
+// fails.
+func (cl *Client) SetVideoMuted(muted bool) error {
+	if cl.videoTrack == nil {
+		return ErrTrackNotFound
+	}
+	changed, err := cl.setTrackMuted(cl.videoTrack, muted)
+	if err != nil {
+		return err
+	}
+	if changed && !muted {
+		cl.onKeyframeRequest()
+	}
+	return nil
+}
+
+// SetAudioMuted pauses or resumes the local audio track. Packets written
+// while muted are dropped. The audio transceiver is switched to recvonly,
+// or inactive if sending only, and a running call is renegotiated. The
+// mute is undone if the renegotiation fails.
+func (cl *Client) SetAudioMuted(muted bool) error {
+	if cl.audioTrack == nil {
+		return ErrTrackNotFound
+	}
+	_, err := cl.setTrackMuted(cl.audioTrack, muted)
+	return err
+}
+
+// SetMuted pauses or resumes the track. Packets written while muted are
+// dropped. On unmute of a video track a keyframe is requested.
+func (lt *LocalTrack) SetMuted(muted bool) {
+	if lt.track.setMuted(muted) && !muted && lt.track.Kind() == webrtc.RTPCodecTypeVideo {
+		lt.onKeyframeRequest()
+	}
+}
@@ -0,0 +1,67 @@
+package ghost
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSetMutedDirection(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []ClientOption
+		kind           webrtc.RTPCodecType
+		muted, unmuted webrtc.RTPTransceiverDirection
+	}{
+		{"audio", nil, webrtc.RTPCodecTypeAudio,
+			webrtc.RTPTransceiverDirectionRecvonly, webrtc.RTPTransceiverDirectionSendrecv},
+		{"audio send only", []ClientOption{WithSendOnly()}, webrtc.RTPCodecTypeAudio,
+			webrtc.RTPTransceiverDirectionInactive, webrtc.RTPTransceiverDirectionSendonly},
+		{"video", nil, webrtc.RTPCodecTypeVideo,
+			webrtc.RTPTransceiverDirectionRecvonly, webrtc.RTPTransceiverDirectionSendrecv},
+		{"video send only", []ClientOption{WithSendOnly()}, webrtc.RTPCodecTypeVideo,
+			webrtc.RTPTransceiverDirectionInactive, webrtc.RTPTransceiverDirectionSendonly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newClient(testCallInfo{}, tt.opts...)
+			cl.newSignalingCall = (&testConference{}).newCall
+			defer cl.Destroy()
+			if _, _, err := cl.initConnection(); err != nil {
+				t.Fatal(err)
+			}
+			peerConnection := cl.activePeerConnection()
+
+			setMuted := cl.SetAudioMuted
+			if tt.kind == webrtc.RTPCodecTypeVideo {
+				setMuted = cl.SetVideoMuted
+			}
+			direction := func() webrtc.RTPTransceiverDirection {
+				var direction webrtc.RTPTransceiverDirection
+				for _, transceiver := range peerConnection.GetTransceivers() {
+					if transceiver.Kind() == tt.kind {
+						direction = transceiver.Direction()
+					}
+				}
+				return direction
+			}
+
+			if err := setMuted(true); err != nil {
+				t.Fatal(err)
+			}
+			if got := direction(); got != tt.muted {
+				t.Fatalf("muted %s is %s, want %s", tt.kind, got, tt.muted)
+			}
+			if err := setMuted(false); err != nil {
+				t.Fatal(err)
+			}
+			if got := direction(); got != tt.unmuted {
+				t.Fatalf("unmuted %s is %s, want %s", tt.kind, got, tt.unmuted)
+			}
+			if n := len(peerConnection.GetTransceivers()); n != 2 {
+				t.Fatalf("got %d transceivers, want 2", n)
+			}
+		})
+	}
+}
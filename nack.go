@@ -0,0 +1,156 @@
+package ghost
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/rtp"
+)
+
+const (
+	defaultRetransmissionPackets    = 1024
+	defaultRetransmissionPacketRate = 500
+	maxRetransmissionPackets        = 1 << 15
+)
+
+// RetransmissionConfig configures the buffer of sent video packets which
+// are retransmitted when the remote peer reports them lost via NACK.
+type RetransmissionConfig struct {
+	// Packets number of packets kept. Rounded up to a power of two.
+	Packets int
+	// Window if set, sizes the buffer to hold the packets sent within
+	// this duration at PacketRate. Overrides Packets.
+	Window time.Duration
+	// PacketRate expected packets per second. Defaults to 500.
+	PacketRate int
+}
+
+// WithRetransmission configures the retransmission buffer. By default the
+// last 1024 video packets are kept.
+func WithRetransmission(config RetransmissionConfig) ClientOption {
+	return func(h *Client) {
+		h.retransmission = config
+	}
+}
+
+// WithNoRetransmission deactivates the retransmission of lost packets.
+func WithNoRetransmission() ClientOption {
+	return func(h *Client) {
+		h.retransmission = RetransmissionConfig{Packets: -1}
+	}
+}
+
+// size returns the buffer size as a power of two or 0 if disabled.
+func (c RetransmissionConfig) size() uint16 {
+	packets := c.Packets
+	if c.Window > 0 {
+		packetRate := c.PacketRate
+		if packetRate <= 0 {
+			packetRate = defaultRetransmissionPacketRate
+		}
+		packets = int(c.Window.Seconds() * float64(packetRate))
+	}
+	switch {
+	case packets < 0:
+		return 0
+	case packets == 0:
+		packets = defaultRetransmissionPackets
+	case packets > maxRetransmissionPackets:
+		packets = maxRetransmissionPackets
+	}
+	size := 1
+	for size < packets {
+		size <<= 1
+	}
+	return uint16(size)
+}
+
+// configureRetransmission registers the nack responder and the counter of
+// retransmitted packets.
+func (cl *Client) configureRetransmission(interceptReg *interceptor.Registry) error {
+	size := cl.retransmission.size()
+	if size == 0 {
+		return nil
+	}
+	responder, err := nack.NewResponderInterceptor(nack.ResponderSize(size))
+	if err != nil {
+		return err
+	}
+	// The counter has to be bound before the responder, so it sees the
+	// packets resent by the responder.
+	interceptReg.Add(cl.retransmissions)
+	interceptReg.Add(responder)
+	return nil
+}
+
+// retransmissionCounter counts resent packets of local streams. As packets
+// are resent with the original sequence number, every packet not newer than
+// the latest one is a retransmission.
+type retransmissionCounter struct {
+	interceptor.NoOp
+	mu      sync.Mutex
+	streams map[uint32]*retransmissionStream
+}
+
+type retransmissionStream struct {
+	started bool
+	lastSeq uint16
+	count   uint64
+}
+
+func newRetransmissionCounter() *retransmissionCounter {
+	return &retransmissionCounter{streams: map[uint32]*retransmissionStream{}}
+}
+
+// NewInterceptor implements interceptor.Factory. The counter is shared by
+// all peer connections of the client.
+func (r *retransmissionCounter) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return r, nil
+}
+
+// Close implements interceptor.Interceptor. The counter is kept, so it
+// can be shared.
+func (r *retransmissionCounter) Close() error {
+	return nil
+}
+
+// BindLocalStream implements interceptor.Interceptor
+func (r *retransmissionCounter) BindLocalStream(info *interceptor.StreamInfo,
+	writer interceptor.RTPWriter) interceptor.RTPWriter {
+	r.mu.Lock()
+	stream := &retransmissionStream{}
+	r.streams[info.SSRC] = stream
+	r.mu.Unlock()
+
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte,
+		attributes interceptor.Attributes) (int, error) {
+		r.mu.Lock()
+		if stream.started && int16(header.SequenceNumber-stream.lastSeq) <= 0 {
+			stream.count++
+		} else {
+			stream.started = true
+			stream.lastSeq = header.SequenceNumber
+		}
+		r.mu.Unlock()
+		return writer.Write(header, payload, attributes)
+	})
+}
+
+// UnbindLocalStream implements interceptor.Interceptor
+func (r *retransmissionCounter) UnbindLocalStream(info *interceptor.StreamInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.streams, info.SSRC)
+}
+
+// count returns the number of retransmitted packets of ssrc.
+func (r *retransmissionCounter) count(ssrc uint32) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stream, ok := r.streams[ssrc]; ok {
+		return stream.count
+	}
+	return 0
+}
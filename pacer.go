@@ -0,0 +1,149 @@
+package ghost
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	defaultPacingFactor   = 1.5
+	defaultPacerBitrate   = 1000000
+	defaultPacerBurst     = 20 * time.Millisecond
+	defaultPacerQueueSize = 1024
+	pacerInterval         = 5 * time.Millisecond
+	// bytes added per packet for the rtp header
+	rtpHeaderOverhead = 12
+	// the budget always allows a full size packet
+	minPacerBudget = 1500
+)
+
+// ErrPacerQueueFull is returned by the paced video track if the packet was
+// dropped because the queue is full.
+var ErrPacerQueueFull = errors.New("ghost: pacer queue full")
+
+// PacerConfig configures the leaky bucket pacer of the local video track.
+type PacerConfig struct {
+	// Factor multiplied with the target bitrate to get the pacing rate.
+	// Defaults to 1.5.
+	Factor float64
+	// DefaultBitrate in bits per second used as long as no target bitrate
+	// is estimated. Defaults to 1Mbps.
+	DefaultBitrate int
+	// Burst amount of data at pacing rate which may be sent at once.
+	// Defaults to 20ms.
+	Burst time.Duration
+	// QueueSize maximum number of packets waiting. Defaults to 1024.
+	QueueSize int
+}
+
+// WithPacer paces the packets written to the local video track according
+// to the target bitrate, so large keyframes are spread out over time
+// instead of being sent in a single burst. Audio is not paced.
+func WithPacer(config PacerConfig) ClientOption {
+	return func(h *Client) {
+		h.pacerConfig = &config
+	}
+}
+
+// pacer is a RTPWriter queueing packets, which are written by a leaky
+// bucket.
+type pacer struct {
+	writer  CodecWriter
+	config  PacerConfig
+	bitrate func() int
+	queue   chan *rtp.Packet
+	closeCh chan struct{}
+}
+
+func newPacer(writer CodecWriter, config PacerConfig, bitrate func() int,
+	closeCh chan struct{}) *pacer {
+	if config.Factor <= 0 {
+		config.Factor = defaultPacingFactor
+	}
+	if config.DefaultBitrate <= 0 {
+		config.DefaultBitrate = defaultPacerBitrate
+	}
+	if config.Burst <= 0 {
+		config.Burst = defaultPacerBurst
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultPacerQueueSize
+	}
+	p := &pacer{
+		writer:  writer,
+		config:  config,
+		bitrate: bitrate,
+		queue:   make(chan *rtp.Packet, config.QueueSize),
+		closeCh: closeCh,
+	}
+	return p
+}
+
+// WriteRTP implements RTPWriter. The packet is copied and queued.
+func (p *pacer) WriteRTP(packet *rtp.Packet) error {
+	select {
+	case p.queue <- packet.Clone():
+		return nil
+	default:
+		return ErrPacerQueueFull
+	}
+}
+
+// MimeType implements CodecWriter
+func (p *pacer) MimeType() string {
+	return p.writer.MimeType()
+}
+
+// rate returns the pacing rate in bytes per second.
+func (p *pacer) rate() float64 {
+	bitrate := p.bitrate()
+	if bitrate <= 0 {
+		bitrate = p.config.DefaultBitrate
+	}
+	return float64(bitrate) * p.config.Factor / 8
+}
+
+func (p *pacer) run() {
+	ticker := time.NewTicker(pacerInterval)
+	defer ticker.Stop()
+
+	var pending *rtp.Packet
+	budget := 0.0
+	last := time.Now()
+	for {
+		select {
+		case <-p.closeCh:
+			return
+		case now := <-ticker.C:
+			rate := p.rate()
+			budget += rate * now.Sub(last).Seconds()
+			last = now
+			maxBudget := rate * p.config.Burst.Seconds()
+			if maxBudget < minPacerBudget {
+				maxBudget = minPacerBudget
+			}
+			if budget > maxBudget {
+				budget = maxBudget
+			}
+
+			for budget > 0 {
+				if pending == nil {
+					select {
+					case pending = <-p.queue:
+					default:
+					}
+				}
+				if pending == nil {
+					break
+				}
+				budget -= float64(len(pending.Payload) + rtpHeaderOverhead)
+				// the writer of the packet already returned, errors of single
+				// packets are dropped like lost packets
+				_ = p.writer.WriteRTP(pending)
+				pending = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package ghost
+
+import (
+	"context"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ReconnectPolicy configures how a lost connection is recovered.
+// Zero values are replaced by the defaults of DefaultReconnectPolicy.
+type ReconnectPolicy struct {
+	// DisconnectedTimeout is the time ICE may stay disconnected before
+	// recovery is started. A failed ICE connection is recovered immediately.
+	DisconnectedTimeout time.Duration
+	// ICERestartTimeout is the time an ICE restart may take before falling
+	// back to a full re-call.
+	ICERestartTimeout time.Duration
+	// CallTimeout limits each re-call attempt including the time to get
+	// connected.
+	CallTimeout time.Duration
+	// InitialBackoff is the delay before the first re-call. It is doubled
+	// after each failed attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two re-calls.
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of re-calls before giving up. A negative
+	// value means no limit.
+	MaxAttempts int
+}
+
+// DefaultReconnectPolicy returns the policy used for unset fields.
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		DisconnectedTimeout: 3 * time.Second,
+		ICERestartTimeout:   10 * time.Second,
+		CallTimeout:         30 * time.Second,
+		InitialBackoff:      1 * time.Second,
+		MaxBackoff:          30 * time.Second,
+		MaxAttempts:         5,
+	}
+}
+
+// WithAutoReconnect activates the automatic recovery of a lost connection.
+// An ICE restart is tried first. If that does not succeed, the call is
+// set up again with backoff. The tracks handed out via the ConnectedHandler
+// stay valid, so the handler is only called on the first connect.
+// If all attempts fail, the TerminatedHandler is called.
+func WithAutoReconnect(policy ReconnectPolicy) ClientOption {
+	return func(h *Client) {
+		defaults := DefaultReconnectPolicy()
+		if policy.DisconnectedTimeout <= 0 {
+			policy.DisconnectedTimeout = defaults.DisconnectedTimeout
+		}
+		if policy.ICERestartTimeout <= 0 {
+			policy.ICERestartTimeout = defaults.ICERestartTimeout
+		}
+		if policy.CallTimeout <= 0 {
+			policy.CallTimeout = defaults.CallTimeout
+		}
+		if policy.InitialBackoff <= 0 {
+			policy.InitialBackoff = defaults.InitialBackoff
+		}
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = defaults.MaxBackoff
+		}
+		if policy.MaxAttempts == 0 {
+			policy.MaxAttempts = defaults.MaxAttempts
+		}
+		h.reconnectPolicy = &policy
+	}
+}
+
+// startRecovery starts the recovery unless auto-reconnect is disabled,
+// a recovery is already running or the call is about to end.
+func (cl *Client) startRecovery(failed bool) {
+	if cl.reconnectPolicy == nil {
+		return
+	}
+	cl.reconnectMu.Lock()
+	defer cl.reconnectMu.Unlock()
+	if !cl.callStarted || cl.recovering || cl.terminating {
+		return
+	}
+	if !cl.enterRoutine() {
+		return
+	}
+	cl.recovering = true
+	// drop the notification of the previous connect
+	cl.drainConnected()
+	go func() {
+		gaveUp := cl.recover(failed)
+		cl.reconnectMu.Lock()
+		cl.recovering = false
+		cl.reconnectMu.Unlock()
+		cl.routines.Done()
+
+		if gaveUp {
+			// outside of the routine, the TerminatedHandler may call Destroy
+			cl.logger.Error("Failed to recover connection. Giving up")
+			cl.reconnectMu.Lock()
+			cl.terminating = true
+			cl.reconnectMu.Unlock()
+			cl.setConnectionState(ConnectionLayerSignaling, ConnectionStateFailed)
+			cl.notifyTerminated(&CallError{Kind: ErrICEFailed, Op: "recover connection"})
+		}
+	}()
+}
+
+// recover restores the connection. Returns true if all attempts failed.
+func (cl *Client) recover(failed bool) bool {
+	policy := cl.reconnectPolicy
+
+	if !failed {
+		// give ice the chance to recover on its own
+		if cl.waitConnected(policy.DisconnectedTimeout) {
+			return false
+		}
+	}
+
+	cl.logger.Info("Connection lost. Restarting ICE")
+	if err := cl.restartICE(); err != nil {
+		cl.logger.Warn("ICE restart failed: %s", err)
+		cl.emitError(err)
+	} else if cl.waitConnected(policy.ICERestartTimeout) {
+		cl.logger.Info("Connection recovered by ICE restart")
+		return false
+	}
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; policy.MaxAttempts < 0 || attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-cl.closeCh:
+			return false
+		}
+		if cl.isTerminating() {
+			return false
+		}
+
+		cl.logger.Info("Re-calling. Attempt %d", attempt)
+		if err := cl.recall(); err != nil {
+			cl.logger.Warn("Re-call failed: %s", err)
+			cl.emitError(err)
+		} else if cl.waitConnected(policy.CallTimeout) {
+			cl.logger.Info("Connection recovered by re-call")
+			return false
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+	return true
+}
+
+// restartICE sends an offer with new ice credentials via the sdp-update
+// path and waits for the answer.
+func (cl *Client) restartICE() error {
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		cl.reconnectPolicy.ICERestartTimeout)
+	defer cancel()
+
+	cl.drainConnected()
+	return cl.negotiate(ctx, &webrtc.OfferOptions{ICERestart: true})
+}
+
+// recall replaces peer connection and signaling and starts a new call.
+func (cl *Client) recall() error {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		cl.reconnectPolicy.CallTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-cl.closeCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// no offer is sent on the replaced peer connection meanwhile
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+
+	oldPeerConnection, oldCall, err := cl.initConnection()
+	if err != nil {
+		return err
+	}
+	if oldCall != nil {
+		oldCall.Close()
+	}
+	if oldPeerConnection != nil {
+		oldPeerConnection.Close()
+	}
+
+	cl.drainConnected()
+	return cl.startCall(ctx)
+}
+
+// waitConnected waits up to timeout for ice to get connected.
+func (cl *Client) waitConnected(timeout time.Duration) bool {
+	if cl.activePeerConnection().ICEConnectionState() == webrtc.ICEConnectionStateConnected {
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-cl.iceConnectedCh:
+		return true
+	case <-timer.C:
+		return false
+	case <-cl.closeCh:
+		return false
+	}
+}
+
+func (cl *Client) drainConnected() {
+	select {
+	case <-cl.iceConnectedCh:
+	default:
+	}
+}
+
+func (cl *Client) isTerminating() bool {
+	cl.reconnectMu.Lock()
+	defer cl.reconnectMu.Unlock()
+	return cl.terminating
+}
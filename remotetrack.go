@@ -0,0 +1,88 @@
+package ghost
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// RemoteTrack describes a track received from the conference. In SFU mode
+// there is one remote track per participant and media kind.
+type RemoteTrack struct {
+	ID          string
+	StreamID    string
+	SSRC        uint32
+	RID         string
+	Kind        string
+	MimeType    string
+	ClockRate   uint32
+	PayloadType uint8
+
+	mu            sync.Mutex
+	packetHandler MediaReceivedHandler
+	endedHandler  func()
+	ended         bool
+}
+
+// RemoteTrackHandler called when a new remote track is received. Handlers of
+// the track should be set within this call to not miss any packets.
+type RemoteTrackHandler func(track *RemoteTrack)
+
+// SetRemoteTrackHandler forwards new remote tracks including their metadata.
+func (cl *Client) SetRemoteTrackHandler(handler RemoteTrackHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
+	cl.remoteTrackHandler = handler
+}
+
+func newRemoteTrack(track *webrtc.TrackRemote) *RemoteTrack {
+	return &RemoteTrack{
+		ID:          track.ID(),
+		StreamID:    track.StreamID(),
+		SSRC:        uint32(track.SSRC()),
+		RID:         track.RID(),
+		Kind:        track.Kind().String(),
+		MimeType:    track.Codec().MimeType,
+		ClockRate:   track.Codec().ClockRate,
+		PayloadType: uint8(track.PayloadType()),
+	}
+}
+
+// SetPacketHandler forwards the rtp packets of this track.
+func (rt *RemoteTrack) SetPacketHandler(handler MediaReceivedHandler) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.packetHandler = handler
+}
+
+// SetEndedHandler sets a callback which is called once the track ended.
+// If the track has already ended, handler is called immediately.
+func (rt *RemoteTrack) SetEndedHandler(handler func()) {
+	rt.mu.Lock()
+	ended := rt.ended
+	rt.endedHandler = handler
+	rt.mu.Unlock()
+	if ended && handler != nil {
+		handler()
+	}
+}
+
+func (rt *RemoteTrack) handlePacket(p *rtp.Packet) {
+	rt.mu.Lock()
+	handler := rt.packetHandler
+	rt.mu.Unlock()
+	if handler != nil {
+		handler(p)
+	}
+}
+
+func (rt *RemoteTrack) end() {
+	rt.mu.Lock()
+	rt.ended = true
+	handler := rt.endedHandler
+	rt.mu.Unlock()
+	if handler != nil {
+		handler()
+	}
+}
@@ -0,0 +1,270 @@
+package ghost
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/rtp/codecs/av1/obu"
+	"github.com/pion/webrtc/v3"
+)
+
+// payload size of the packets created by the SampleWriter
+const sampleMTU = 1200
+
+// Sample is a media frame to be sent. Video frames of H264 and H265 are in
+// Annex-B format, AV1 frames are a sequence of OBUs with size fields.
+type Sample struct {
+	Data     []byte
+	Duration time.Duration
+	// PTS presentation timestamp relative to the first sample. If all
+	// samples have a zero PTS, the timestamps are derived from Duration.
+	PTS time.Duration
+}
+
+// SampleWriter packetizes samples and writes them as rtp packets. Sequence
+// numbers and timestamps are handled by the writer, SSRC and payload type
+// by the track.
+type SampleWriter interface {
+	WriteSample(sample Sample) error
+}
+
+// NewSampleWriter creates a SampleWriter for the codec mimeType writing
+// to writer.
+func NewSampleWriter(writer RTPWriter, mimeType string) SampleWriter {
+	return newSampleWriter(writer, func() string { return mimeType })
+}
+
+// VideoSampleWriter returns a SampleWriter for the local video track which
+// packetizes for the negotiated codec, or nil if no video is sent. It can
+// be used as soon as the ConnectedHandler was called.
+func (cl *Client) VideoSampleWriter() SampleWriter {
+	if cl.videoSampleWriter == nil {
+		return nil
+	}
+	return cl.videoSampleWriter
+}
+
+// AudioSampleWriter returns a SampleWriter for the local opus track, or
+// nil if no audio is sent.
+func (cl *Client) AudioSampleWriter() SampleWriter {
+	if cl.audioSampleWriter == nil {
+		return nil
+	}
+	return cl.audioSampleWriter
+}
+
+type sampleWriter struct {
+	writer   RTPWriter
+	mimeType func() string
+
+	mu        sync.Mutex
+	codec     string
+	payloader rtp.Payloader
+	clockRate uint32
+	sequencer rtp.Sequencer
+	started   bool
+	usePTS    bool
+	base      uint32
+	timestamp uint32
+}
+
+func newSampleWriter(writer RTPWriter, mimeType func() string) *sampleWriter {
+	return &sampleWriter{
+		writer:    writer,
+		mimeType:  mimeType,
+		sequencer: rtp.NewRandomSequencer(),
+	}
+}
+
+// WriteSample implements SampleWriter
+func (sw *sampleWriter) WriteSample(sample Sample) error {
+	mimeType := sw.mimeType()
+	if mimeType == "" {
+		return ErrCodecNotNegotiated
+	}
+
+	sw.mu.Lock()
+	if !strings.EqualFold(mimeType, sw.codec) {
+		payloader, clockRate, err := newPayloader(mimeType)
+		if err != nil {
+			sw.mu.Unlock()
+			return err
+		}
+		sw.codec = mimeType
+		sw.payloader = payloader
+		sw.clockRate = clockRate
+	}
+	if !sw.started {
+		sw.started = true
+		sw.base = rand.Uint32()
+		sw.timestamp = sw.base
+	}
+	if sample.PTS > 0 {
+		sw.usePTS = true
+	}
+	timestamp := sw.timestamp
+	if sw.usePTS {
+		timestamp = sw.base + sw.samples(sample.PTS)
+	}
+	sw.timestamp = timestamp + sw.samples(sample.Duration)
+
+	payloads := sw.payloader.Payload(sampleMTU, sample.Data)
+	video := !strings.HasPrefix(strings.ToLower(mimeType), "audio/")
+	packets := make([]*rtp.Packet, len(payloads))
+	for i, payload := range payloads {
+		packets[i] = &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         video && i == len(payloads)-1,
+				SequenceNumber: sw.sequencer.NextSequenceNumber(),
+				Timestamp:      timestamp,
+			},
+			Payload: payload,
+		}
+	}
+	sw.mu.Unlock()
+
+	for _, p := range packets {
+		if err := sw.writer.WriteRTP(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// samples converts a duration to rtp clock units.
+func (sw *sampleWriter) samples(d time.Duration) uint32 {
+	return uint32(uint64(d/time.Microsecond) * uint64(sw.clockRate) / 1000000)
+}
+
+// newPayloader returns the payloader and clock rate of a codec.
+func newPayloader(mimeType string) (rtp.Payloader, uint32, error) {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return &codecs.VP8Payloader{EnablePictureID: true}, 90000, nil
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return &codecs.VP9Payloader{}, 90000, nil
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return &codecs.H264Payloader{}, 90000, nil
+	case strings.ToLower(webrtc.MimeTypeH265):
+		return &h265Payloader{}, 90000, nil
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		return &av1Payloader{}, 90000, nil
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return &codecs.OpusPayloader{}, 48000, nil
+	}
+	return nil, 0, fmt.Errorf("ghost: no payloader for codec %s", mimeType)
+}
+
+// h265Payloader payloads Annex-B H265 frames (RFC 7798). Nal units larger
+// than the mtu are sent as fragmentation units.
+type h265Payloader struct{}
+
+// Payload implements rtp.Payloader
+func (p *h265Payloader) Payload(mtu uint16, payload []byte) [][]byte {
+	var payloads [][]byte
+	for _, nalu := range splitAnnexB(payload) {
+		if len(nalu) < 2 {
+			continue
+		}
+		naluType := (nalu[0] >> 1) & 0x3F
+		if naluType == 35 { // access unit delimiter
+			continue
+		}
+		if len(nalu) <= int(mtu) {
+			payloads = append(payloads, append([]byte{}, nalu...))
+			continue
+		}
+
+		// fragmentation unit: payload header, fu header, fragment
+		maxFragment := int(mtu) - 3
+		if maxFragment <= 0 {
+			return nil
+		}
+		data := nalu[2:]
+		for start := 0; start < len(data); start += maxFragment {
+			end := start + maxFragment
+			if end > len(data) {
+				end = len(data)
+			}
+			fuHeader := naluType
+			if start == 0 {
+				fuHeader |= 0x80
+			}
+			if end == len(data) {
+				fuHeader |= 0x40
+			}
+			out := make([]byte, 0, 3+end-start)
+			out = append(out, (nalu[0]&0x81)|49<<1, nalu[1], fuHeader)
+			payloads = append(payloads, append(out, data[start:end]...))
+		}
+	}
+	return payloads
+}
+
+// splitAnnexB returns the nal units of an Annex-B byte stream.
+func splitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	for len(data) > 0 {
+		start := bytes.Index(data, []byte{0, 0, 1})
+		if start < 0 {
+			nalus = append(nalus, data)
+			break
+		}
+		// drop the leading zero of 4 byte start codes
+		if nalu := bytes.TrimRight(data[:start], "\x00"); len(nalu) > 0 {
+			nalus = append(nalus, nalu)
+		}
+		data = data[start+3:]
+	}
+	return nalus
+}
+
+// av1Payloader payloads AV1 temporal units. The OBUs are sent without
+// size fields, temporal delimiters are dropped.
+type av1Payloader struct {
+	codecs.AV1Payloader
+}
+
+// Payload implements rtp.Payloader
+func (p *av1Payloader) Payload(mtu uint16, payload []byte) [][]byte {
+	var payloads [][]byte
+	for len(payload) > 0 {
+		headerSize := 1
+		if payload[0]&0x04 != 0 {
+			headerSize = 2
+		}
+		if len(payload) < headerSize {
+			break
+		}
+		header := payload[:headerSize]
+		rest := payload[headerSize:]
+		size := len(rest)
+		if payload[0]&0x02 != 0 {
+			obuSize, n, err := obu.ReadLeb128(rest)
+			if err != nil || int(obuSize) > len(rest)-int(n) {
+				break
+			}
+			rest = rest[n:]
+			size = int(obuSize)
+		}
+		payload = rest[size:]
+
+		obuType := (header[0] >> 3) & 0x0F
+		if obuType == 2 { // temporal delimiter
+			continue
+		}
+		o := make([]byte, 0, headerSize+size)
+		o = append(o, header[0]&^0x02)
+		o = append(o, header[1:]...)
+		o = append(o, rest[:size]...)
+		payloads = append(payloads, p.AV1Payloader.Payload(mtu, o)...)
+	}
+	return payloads
+}
@@ -0,0 +1,141 @@
+package ghost
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitAnnexB(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"four byte start codes", []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x65, 0x88},
+			[][]byte{{0x67, 0x42}, {0x65, 0x88}}},
+		{"three byte start codes", []byte{0, 0, 1, 0x67, 0x42, 0, 0, 1, 0x65, 0x88},
+			[][]byte{{0x67, 0x42}, {0x65, 0x88}}},
+		{"without start code", []byte{0x65, 0x88}, [][]byte{{0x65, 0x88}}},
+		{"empty", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitAnnexB(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d nal units, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Fatalf("nal unit %d: got %x, want %x", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// sequence returns n bytes counting up from start.
+func sequence(start byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = start + byte(i)
+	}
+	return data
+}
+
+func TestH265PayloaderRoundTrip(t *testing.T) {
+	startCode := []byte{0, 0, 0, 1}
+	vps := append([]byte{0x40, 0x01}, sequence(0x10, 4)...)
+	idr := append([]byte{0x26, 0x01}, sequence(0x20, 40)...)
+	aud := []byte{0x46, 0x01, 0x50}
+	join := func(nalus ...[]byte) []byte {
+		var out []byte
+		for _, nalu := range nalus {
+			out = append(out, startCode...)
+			out = append(out, nalu...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		frame    []byte
+		mtu      uint16
+		payloads int
+		want     []byte
+	}{
+		{"single nal units", join(vps, idr), 1200, 2, join(vps, idr)},
+		{"access unit delimiter dropped", join(aud, vps), 1200, 1, join(vps)},
+		{"fragmented", join(vps, idr), 16, 5, join(vps, idr)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := (&h265Payloader{}).Payload(tt.mtu, tt.frame)
+			if len(payloads) != tt.payloads {
+				t.Fatalf("got %d payloads, want %d", len(payloads), tt.payloads)
+			}
+			d := &h265Depacketizer{}
+			var got []byte
+			for _, payload := range payloads {
+				if len(payload) > int(tt.mtu) {
+					t.Fatalf("payload of %d bytes exceeds the mtu", len(payload))
+				}
+				out, err := d.Unmarshal(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, out...)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAV1PayloaderRoundTrip(t *testing.T) {
+	temporalDelimiter := []byte{0x12, 0x00}
+	sequenceHeader := append([]byte{0x0a, 0x04}, sequence(0x10, 4)...)
+	frame := append([]byte{0x32, 0x28}, sequence(0x20, 40)...)
+	join := func(obus ...[]byte) []byte {
+		var out []byte
+		for _, o := range obus {
+			out = append(out, o...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		unit []byte
+		mtu  uint16
+		want []byte
+	}{
+		{"temporal delimiter dropped", join(temporalDelimiter, frame), 1200, frame},
+		{"sequence header and frame", join(sequenceHeader, frame), 1200, join(sequenceHeader, frame)},
+		{"fragmented", join(temporalDelimiter, sequenceHeader, frame), 16, join(sequenceHeader, frame)},
+		{"obu without size field", []byte{0x30, 0xaa, 0xbb}, 1200, []byte{0x32, 0x02, 0xaa, 0xbb}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := (&av1Payloader{}).Payload(tt.mtu, tt.unit)
+			d := &av1Depacketizer{}
+			var got []byte
+			for _, payload := range payloads {
+				if len(payload) > int(tt.mtu) {
+					t.Fatalf("payload of %d bytes exceeds the mtu", len(payload))
+				}
+				out, err := d.Unmarshal(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, out...)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package ghost
+
+import (
+	"github.com/pion/sdp/v3"
+)
+
+// LocalSDPMutator modifies the local session description before it is sent
+// to the conference. sdpType is either "offer" or "answer".
+type LocalSDPMutator func(sdpType string, desc *sdp.SessionDescription) error
+
+// RemoteSDPObserver is called with every session description received from
+// the conference. The description must not be modified.
+type RemoteSDPObserver func(sdpType string, desc *sdp.SessionDescription)
+
+// WithLocalSDPMutator modifies local session descriptions, e.g. to add
+// bandwidth lines or attributes. Mutators are called after the eyeson
+// attributes have been added.
+func WithLocalSDPMutator(mutator LocalSDPMutator) ClientOption {
+	return func(h *Client) {
+		h.localSDPMutators = append(h.localSDPMutators, mutator)
+	}
+}
+
+// WithRemoteSDPObserver observes the session descriptions of the conference.
+func WithRemoteSDPObserver(observer RemoteSDPObserver) ClientOption {
+	return func(h *Client) {
+		h.remoteSDPObservers = append(h.remoteSDPObservers, observer)
+	}
+}
+
+// localSDP adds the eyeson session attributes to an offer and applies the
+// local mutators.
+func (cl *Client) localSDP(sdpType string, raw string) (string, error) {
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(raw)); err != nil {
+		return "", err
+	}
+
+	if sdpType == "offer" {
+		if cl.sfuCapable {
+			desc.WithPropertyAttribute("sfu-capable")
+		}
+		if cl.useConfProtocol {
+			desc.WithPropertyAttribute("eyeson-datachan-capable")
+			desc.WithPropertyAttribute("eyeson-datachan-keepalive")
+			if cl.seppMessaging() {
+				desc.WithPropertyAttribute("eyeson-sepp-messaging")
+			}
+		}
+		if cl.tricklingICE() {
+			desc.WithValueAttribute("ice-options", "trickle")
+		}
+	}
+
+	for _, mutate := range cl.localSDPMutators {
+		if err := mutate(sdpType, desc); err != nil {
+			return "", err
+		}
+	}
+
+	out, err := desc.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// observeRemoteSDP passes a received session description to the observers.
+func (cl *Client) observeRemoteSDP(sdpType string, raw string) {
+	if len(cl.remoteSDPObservers) == 0 {
+		return
+	}
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(raw)); err != nil {
+		cl.logger.Warn("Failed to parse remote sdp: %s", err)
+		return
+	}
+	for _, observe := range cl.remoteSDPObservers {
+		observe(sdpType, desc)
+	}
+}
@@ -0,0 +1,227 @@
+package ghost
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+const testSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=sendrecv\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n"
+
+type testCallInfo struct{}
+
+func (testCallInfo) GetClientID() string           { return "client" }
+func (testCallInfo) GetConfID() string             { return "conf" }
+func (testCallInfo) GetSigEndpoint() string        { return "" }
+func (testCallInfo) GetAuthToken() string          { return "" }
+func (testCallInfo) GetStunServers() []string      { return nil }
+func (testCallInfo) GetTurnServerURLs() []string   { return nil }
+func (testCallInfo) GetTurnServerPassword() string { return "" }
+func (testCallInfo) GetTurnServerUsername() string { return "" }
+func (testCallInfo) GetDisplayname() string        { return "ghost" }
+
+func parseSDP(t *testing.T, raw string) *sdp.SessionDescription {
+	t.Helper()
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(raw)); err != nil {
+		t.Fatalf("failed to parse sdp: %s", err)
+	}
+	return desc
+}
+
+func TestLocalSDPSessionAttributes(t *testing.T) {
+	eyeson := []string{"sfu-capable", "eyeson-datachan-capable",
+		"eyeson-datachan-keepalive", "eyeson-sepp-messaging"}
+	tests := []struct {
+		name      string
+		opts      []ClientOption
+		messaging bool
+		sdpType   string
+		want      []string
+	}{
+		{"offer", nil, true, "offer", eyeson},
+		{"no sfu", []ClientOption{WithNoSFUSupport()}, true, "offer",
+			[]string{"eyeson-datachan-capable", "eyeson-datachan-keepalive", "eyeson-sepp-messaging"}},
+		{"no conf protocol", []ClientOption{WithNoConfProtocol()}, true, "offer",
+			[]string{"sfu-capable"}},
+		{"no sepp messaging", []ClientOption{WithNoSEPPMessaging()}, true, "offer",
+			[]string{"sfu-capable", "eyeson-datachan-capable", "eyeson-datachan-keepalive"}},
+		{"signaling without messaging", nil, false, "offer",
+			[]string{"sfu-capable", "eyeson-datachan-capable", "eyeson-datachan-keepalive"}},
+		{"answer", nil, true, "answer", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newClient(testCallInfo{}, tt.opts...)
+			cl.call = &testCall{messaging: tt.messaging}
+			out, err := cl.localSDP(tt.sdpType, testSDP)
+			if err != nil {
+				t.Fatal(err)
+			}
+			desc := parseSDP(t, out)
+			for _, key := range eyeson {
+				_, found := desc.Attribute(key)
+				wanted := false
+				for _, w := range tt.want {
+					wanted = wanted || w == key
+				}
+				if found != wanted {
+					t.Errorf("attribute %s: got %v, want %v", key, found, wanted)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalSDPMutators(t *testing.T) {
+	var calls []string
+	mutator := func(name string) LocalSDPMutator {
+		return func(sdpType string, desc *sdp.SessionDescription) error {
+			calls = append(calls, name+":"+sdpType)
+			desc.WithValueAttribute("x-mutator", name)
+			return nil
+		}
+	}
+	cl := newClient(testCallInfo{}, WithLocalSDPMutator(mutator("first")),
+		WithLocalSDPMutator(mutator("second")))
+
+	out, err := cl.localSDP("offer", testSDP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "first:offer" || calls[1] != "second:offer" {
+		t.Fatalf("unexpected mutator calls %v", calls)
+	}
+
+	// mutators run in order after the eyeson attributes were added
+	var keys []string
+	for _, attr := range parseSDP(t, out).Attributes {
+		keys = append(keys, attr.Key+"="+attr.Value)
+	}
+	want := []string{"sfu-capable=", "eyeson-datachan-capable=", "eyeson-datachan-keepalive=",
+		"x-mutator=first", "x-mutator=second"}
+	if len(keys) != len(want) {
+		t.Fatalf("got attributes %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("got attributes %v, want %v", keys, want)
+		}
+	}
+
+	errMutate := errors.New("mutate")
+	cl = newClient(testCallInfo{}, WithLocalSDPMutator(
+		func(string, *sdp.SessionDescription) error { return errMutate }))
+	if _, err := cl.localSDP("answer", testSDP); !errors.Is(err, errMutate) {
+		t.Fatalf("got error %v, want %v", err, errMutate)
+	}
+}
+
+func TestRemoteSDPObservers(t *testing.T) {
+	var calls []string
+	observer := func(name string) RemoteSDPObserver {
+		return func(sdpType string, desc *sdp.SessionDescription) {
+			calls = append(calls, name+":"+sdpType+":"+desc.MediaDescriptions[0].MediaName.Media)
+		}
+	}
+	cl := newClient(testCallInfo{}, WithRemoteSDPObserver(observer("first")),
+		WithRemoteSDPObserver(observer("second")))
+
+	cl.observeRemoteSDP("answer", testSDP)
+	cl.observeRemoteSDP("offer", "invalid")
+	if len(calls) != 2 || calls[0] != "first:answer:audio" || calls[1] != "second:answer:audio" {
+		t.Fatalf("unexpected observer calls %v", calls)
+	}
+}
+
+func TestMediaDirection(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want webrtc.RTPTransceiverDirection
+	}{
+		{"send and receive", nil, webrtc.RTPTransceiverDirectionSendrecv},
+		{"send only", []ClientOption{WithSendOnly()}, webrtc.RTPTransceiverDirectionSendonly},
+		{"receive only", []ClientOption{WithReceiveOnly()}, webrtc.RTPTransceiverDirectionRecvonly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newClient(testCallInfo{}, tt.opts...)
+			defer cl.closeTransport()
+			api, err := cl.newAPI()
+			if err != nil {
+				t.Fatal(err)
+			}
+			peerConnection, _, err := cl.initStack(api)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peerConnection.Close()
+
+			transceivers := peerConnection.GetTransceivers()
+			if len(transceivers) != 2 {
+				t.Fatalf("got %d transceivers, want 2", len(transceivers))
+			}
+			for _, transceiver := range transceivers {
+				if transceiver.Direction() != tt.want {
+					t.Errorf("%s transceiver is %s, want %s", transceiver.Kind(),
+						transceiver.Direction(), tt.want)
+				}
+			}
+
+			// the offer sent matches the local state
+			offer, err := peerConnection.CreateOffer(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := cl.localSDP("offer", offer.SDP)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, media := range parseSDP(t, out).MediaDescriptions {
+				if media.MediaName.Media == "application" {
+					continue
+				}
+				if _, ok := media.Attribute(tt.want.String()); !ok {
+					t.Errorf("%s media is not %s", media.MediaName.Media, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecParametersFmtp(t *testing.T) {
+	tests := []struct {
+		name string
+		fmtp string
+		want string
+	}{
+		{"h264 zero value", H264Parameters{}.Fmtp(), "packetization-mode=1"},
+		{"h264", H264Parameters{ProfileLevelID: "42e01f", LevelAsymmetryAllowed: true}.Fmtp(),
+			"level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"},
+		{"vp9", VP9Parameters{ProfileID: 2}.Fmtp(), "profile-id=2"},
+		{"av1 zero value", AV1Parameters{}.Fmtp(), "profile=0;level-idx=5;tier=0"},
+		{"opus zero value", OpusParameters{}.Fmtp(), ""},
+		{"opus", OpusParameters{Stereo: true, MinPTime: 10}.Fmtp(),
+			"minptime=10;stereo=1;sprop-stereo=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fmtp != tt.want {
+				t.Fatalf("got fmtp %q, want %q", tt.fmtp, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package ghost
+
+import (
+	"context"
+	"errors"
+
+	"github.com/eyeson-team/gosepp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// errTrickleICEUnsupported is returned by signaling calls which
+	// exchange complete session descriptions only.
+	errTrickleICEUnsupported = errors.New("ghost: trickle ice not supported")
+	// errMessagingUnsupported is returned by signaling calls which can't
+	// send conference messages.
+	errMessagingUnsupported = errors.New("ghost: signaling messaging not supported")
+)
+
+// signalingCall is the signaling connection of a call.
+type signalingCall interface {
+	Start(ctx context.Context, offer gosepp.Sdp, displayname string) (gosepp.Sdp, error)
+	UpdateSDP(ctx context.Context, sdp gosepp.Sdp) error
+	Terminate(ctx context.Context) error
+	Close()
+	SetSDPUpdateHandler(handler func(sdp gosepp.Sdp))
+	SetTerminatedHandler(handler func())
+	// TrickleICE reports whether ice candidates can be exchanged after the
+	// offer.
+	TrickleICE() bool
+	SendICECandidate(ctx context.Context, candidate webrtc.ICECandidateInit) error
+	SetICECandidateHandler(handler func(candidate webrtc.ICECandidateInit))
+	// Messaging reports whether conference messages can be sent via the
+	// signaling connection.
+	Messaging() bool
+	SendMessage(ctx context.Context, data []byte) error
+}
+
+// seppCall is the signalingCall of gosepp.
+type seppCall struct {
+	call *gosepp.Call
+}
+
+func (cl *Client) newSEPPCall() (signalingCall, error) {
+	// append the platform version
+	goseppOptions := append([]gosepp.CallOption{}, cl.goseppOptions...)
+	goseppOptions = append(goseppOptions, gosepp.WithPlatformVersion(PlatformVersion))
+
+	call, err := gosepp.NewCall(cl.callInfo, cl.logger, goseppOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &seppCall{call: call}, nil
+}
+
+func (c *seppCall) Start(ctx context.Context, offer gosepp.Sdp, displayname string) (gosepp.Sdp, error) {
+	_, answer, err := c.call.Start(ctx, offer, displayname)
+	return answer, err
+}
+
+func (c *seppCall) UpdateSDP(ctx context.Context, sdp gosepp.Sdp) error {
+	return c.call.UpdateSDP(ctx, sdp)
+}
+
+func (c *seppCall) Terminate(ctx context.Context) error {
+	return c.call.Terminate(ctx)
+}
+
+func (c *seppCall) Close() {
+	c.call.Close()
+}
+
+func (c *seppCall) SetSDPUpdateHandler(handler func(sdp gosepp.Sdp)) {
+	c.call.SetSDPUpdateHandler(handler)
+}
+
+func (c *seppCall) SetTerminatedHandler(handler func()) {
+	c.call.SetTerminatedHandler(handler)
+}
+
+// TrickleICE is not supported by the SEPP calls of gosepp, which exchange
+// complete session descriptions only.
+func (c *seppCall) TrickleICE() bool {
+	return false
+}
+
+func (c *seppCall) SendICECandidate(ctx context.Context, candidate webrtc.ICECandidateInit) error {
+	return errTrickleICEUnsupported
+}
+
+func (c *seppCall) SetICECandidateHandler(handler func(candidate webrtc.ICECandidateInit)) {}
+
+// Messaging is not supported by the SEPP calls of gosepp, so messages are
+// sent via data-channel.
+func (c *seppCall) Messaging() bool {
+	return false
+}
+
+func (c *seppCall) SendMessage(ctx context.Context, data []byte) error {
+	return errMessagingUnsupported
+}
@@ -0,0 +1,124 @@
+package ghost
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// ConnectionLayer identifies the part of the call a ConnectionState
+// belongs to.
+type ConnectionLayer int
+
+const (
+	// ConnectionLayerICE reports the state of the ICE transport.
+	ConnectionLayerICE ConnectionLayer = iota
+	// ConnectionLayerPeer reports the state of the peer connection, which
+	// includes the DTLS transport.
+	ConnectionLayerPeer
+	// ConnectionLayerSignaling reports the state of the signaling (SEPP)
+	// call.
+	ConnectionLayerSignaling
+)
+
+func (l ConnectionLayer) String() string {
+	switch l {
+	case ConnectionLayerICE:
+		return "ice"
+	case ConnectionLayerPeer:
+		return "peer"
+	case ConnectionLayerSignaling:
+		return "signaling"
+	}
+	return "unknown"
+}
+
+// ConnectionState describes the state of one connection layer.
+type ConnectionState int
+
+const (
+	// ConnectionStateNew nothing happened yet.
+	ConnectionStateNew ConnectionState = iota
+	// ConnectionStateConnecting connection is being established.
+	ConnectionStateConnecting
+	// ConnectionStateConnected connection is established.
+	ConnectionStateConnected
+	// ConnectionStateDisconnected connection got lost. This might be
+	// transient and recover without intervention.
+	ConnectionStateDisconnected
+	// ConnectionStateFailed connection failed and will not recover by
+	// itself.
+	ConnectionStateFailed
+	// ConnectionStateClosed connection has been shut down.
+	ConnectionStateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionStateNew:
+		return "new"
+	case ConnectionStateConnecting:
+		return "connecting"
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateDisconnected:
+		return "disconnected"
+	case ConnectionStateFailed:
+		return "failed"
+	case ConnectionStateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ConnectionStateHandler called whenever the state of a connection layer
+// changes.
+type ConnectionStateHandler func(layer ConnectionLayer, state ConnectionState)
+
+// SetConnectionStateHandler forwards a listener callback to receive state
+// changes of the ICE, peer and signaling layer.
+func (cl *Client) SetConnectionStateHandler(handler ConnectionStateHandler) {
+	cl.handlerMu.Lock()
+	defer cl.handlerMu.Unlock()
+	cl.connectionStateHandler = handler
+}
+
+func (cl *Client) setConnectionState(layer ConnectionLayer, state ConnectionState) {
+	cl.logger.Debug("Connection state of %s changed to %s", layer, state)
+	cl.handlerMu.RLock()
+	handler := cl.connectionStateHandler
+	cl.handlerMu.RUnlock()
+	if handler != nil {
+		handler(layer, state)
+	}
+}
+
+func iceConnectionState(state webrtc.ICEConnectionState) ConnectionState {
+	switch state {
+	case webrtc.ICEConnectionStateChecking:
+		return ConnectionStateConnecting
+	case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+		return ConnectionStateConnected
+	case webrtc.ICEConnectionStateDisconnected:
+		return ConnectionStateDisconnected
+	case webrtc.ICEConnectionStateFailed:
+		return ConnectionStateFailed
+	case webrtc.ICEConnectionStateClosed:
+		return ConnectionStateClosed
+	}
+	return ConnectionStateNew
+}
+
+func peerConnectionState(state webrtc.PeerConnectionState) ConnectionState {
+	switch state {
+	case webrtc.PeerConnectionStateConnecting:
+		return ConnectionStateConnecting
+	case webrtc.PeerConnectionStateConnected:
+		return ConnectionStateConnected
+	case webrtc.PeerConnectionStateDisconnected:
+		return ConnectionStateDisconnected
+	case webrtc.PeerConnectionStateFailed:
+		return ConnectionStateFailed
+	case webrtc.PeerConnectionStateClosed:
+		return ConnectionStateClosed
+	}
+	return ConnectionStateNew
+}
@@ -0,0 +1,190 @@
+package ghost
+
+import (
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/stats"
+)
+
+// TrackStats statistics of a single local (outbound) or remote (inbound)
+// track. Loss, jitter and round-trip-time of outbound tracks are taken from
+// the receiver reports of the remote peer.
+type TrackStats struct {
+	TrackID  string
+	Kind     string
+	Outbound bool
+	SSRC     uint32
+	Codec    string
+	// Bitrate in bits per second since the previous stats sample.
+	Bitrate         int
+	PacketsSent     uint64
+	BytesSent       uint64
+	PacketsReceived uint64
+	BytesReceived   uint64
+	PacketsLost     int64
+	FractionLost    float64
+	// NACKCount number of NACKs received for outbound tracks.
+	NACKCount uint32
+	// PacketsRetransmitted number of packets resent on NACK.
+	PacketsRetransmitted uint64
+	// Jitter in seconds.
+	Jitter        float64
+	RoundTripTime time.Duration
+}
+
+// CallStats statistics of all tracks of the call.
+type CallStats struct {
+	Timestamp time.Time
+	Tracks    []TrackStats
+}
+
+// StatsHandler called periodically with the current call statistics.
+type StatsHandler func(stats CallStats)
+
+type bitrateSample struct {
+	bytes     uint64
+	timestamp time.Time
+}
+
+// bitrateSamples the last byte counts per ssrc. Every consumer of the
+// stats keeps its own samples, so the bitrates are calculated over its
+// interval.
+type bitrateSamples map[uint32]bitrateSample
+
+// configureStats registers the stats interceptor which is queried by
+// GetStats.
+func (cl *Client) configureStats(interceptReg *interceptor.Registry) error {
+	statsFactory, err := stats.NewInterceptor()
+	if err != nil {
+		return err
+	}
+	statsFactory.OnNewPeerConnection(func(_ string, getter stats.Getter) {
+		cl.statsMu.Lock()
+		cl.statsGetter = getter
+		cl.statsMu.Unlock()
+	})
+	interceptReg.Add(statsFactory)
+	return nil
+}
+
+// GetStats returns the statistics of all local and remote tracks. The
+// bitrates are calculated since the previous call of GetStats.
+func (cl *Client) GetStats() CallStats {
+	return cl.collectStats(cl.bitrateSamples)
+}
+
+// collectStats returns the statistics with the bitrates since the
+// previous collection with samples.
+func (cl *Client) collectStats(samples bitrateSamples) CallStats {
+	callStats := CallStats{Timestamp: time.Now()}
+
+	cl.statsMu.Lock()
+	defer cl.statsMu.Unlock()
+	peerConnection := cl.activePeerConnection()
+	if cl.statsGetter == nil || peerConnection == nil {
+		return callStats
+	}
+
+	for _, sender := range peerConnection.GetSenders() {
+		track := sender.Track()
+		params := sender.GetParameters()
+		if track == nil || len(params.Encodings) == 0 {
+			continue
+		}
+		ssrc := uint32(params.Encodings[0].SSRC)
+		trackStats := TrackStats{
+			TrackID:  track.ID(),
+			Kind:     track.Kind().String(),
+			Outbound: true,
+			SSRC:     ssrc,
+		}
+		for _, codec := range params.Codecs {
+			if codec.PayloadType == params.Encodings[0].PayloadType {
+				trackStats.Codec = codec.MimeType
+			}
+		}
+		if s := cl.statsGetter.Get(ssrc); s != nil {
+			trackStats.PacketsSent = s.OutboundRTPStreamStats.PacketsSent
+			trackStats.BytesSent = s.OutboundRTPStreamStats.BytesSent
+			trackStats.PacketsLost = s.RemoteInboundRTPStreamStats.PacketsLost
+			trackStats.FractionLost = s.RemoteInboundRTPStreamStats.FractionLost
+			trackStats.Jitter = s.RemoteInboundRTPStreamStats.Jitter
+			trackStats.RoundTripTime = s.RemoteInboundRTPStreamStats.RoundTripTime
+			trackStats.NACKCount = s.OutboundRTPStreamStats.NACKCount
+			trackStats.PacketsRetransmitted = cl.retransmissions.count(ssrc)
+			trackStats.Bitrate = samples.bitrate(ssrc, trackStats.BytesSent, callStats.Timestamp)
+		}
+		callStats.Tracks = append(callStats.Tracks, trackStats)
+	}
+
+	for _, receiver := range peerConnection.GetReceivers() {
+		track := receiver.Track()
+		if track == nil || track.SSRC() == 0 {
+			continue
+		}
+		ssrc := uint32(track.SSRC())
+		trackStats := TrackStats{
+			TrackID: track.ID(),
+			Kind:    track.Kind().String(),
+			SSRC:    ssrc,
+			Codec:   track.Codec().MimeType,
+		}
+		if s := cl.statsGetter.Get(ssrc); s != nil {
+			trackStats.PacketsReceived = s.InboundRTPStreamStats.PacketsReceived
+			trackStats.BytesReceived = s.InboundRTPStreamStats.BytesReceived
+			trackStats.PacketsLost = s.InboundRTPStreamStats.PacketsLost
+			trackStats.Jitter = s.InboundRTPStreamStats.Jitter
+			trackStats.RoundTripTime = s.RemoteOutboundRTPStreamStats.RoundTripTime
+			trackStats.Bitrate = samples.bitrate(ssrc, trackStats.BytesReceived, callStats.Timestamp)
+		}
+		callStats.Tracks = append(callStats.Tracks, trackStats)
+	}
+
+	return callStats
+}
+
+// bitrate calculates the bitrate since the last sample of ssrc.
+func (samples bitrateSamples) bitrate(ssrc uint32, bytes uint64, now time.Time) int {
+	last, ok := samples[ssrc]
+	samples[ssrc] = bitrateSample{bytes: bytes, timestamp: now}
+	elapsed := now.Sub(last.timestamp).Seconds()
+	if !ok || elapsed <= 0 || bytes < last.bytes {
+		return 0
+	}
+	return int(float64(bytes-last.bytes) * 8 / elapsed)
+}
+
+// SetStatsHandler calls handler every interval with the current call
+// statistics until the client is destroyed. A nil handler stops the
+// reporting.
+func (cl *Client) SetStatsHandler(handler StatsHandler, interval time.Duration) {
+	cl.statsMu.Lock()
+	if cl.statsStopCh != nil {
+		close(cl.statsStopCh)
+		cl.statsStopCh = nil
+	}
+	if handler == nil || interval <= 0 {
+		cl.statsMu.Unlock()
+		return
+	}
+	stopCh := make(chan struct{})
+	cl.statsStopCh = stopCh
+	cl.statsMu.Unlock()
+
+	cl.startRoutine(func() {
+		samples := bitrateSamples{}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				handler(cl.collectStats(samples))
+			case <-stopCh:
+				return
+			case <-cl.closeCh:
+				return
+			}
+		}
+	})
+}
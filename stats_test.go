@@ -0,0 +1,34 @@
+package ghost
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBitrateSamples(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name  string
+		bytes uint64
+		after time.Duration
+		want  int
+	}{
+		{"first sample", 1000, 0, 0},
+		{"one second", 2000, time.Second, 8000},
+		{"half a second", 3000, 1500 * time.Millisecond, 16000},
+		{"same time", 4000, 1500 * time.Millisecond, 0},
+		{"counter reset", 100, 2 * time.Second, 0},
+	}
+
+	samples := bitrateSamples{}
+	// a second consumer samples in between without affecting the first
+	other := bitrateSamples{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other.bitrate(1, tt.bytes+500, start.Add(tt.after-time.Millisecond))
+			if got := samples.bitrate(1, tt.bytes, start.Add(tt.after)); got != tt.want {
+				t.Fatalf("got bitrate %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
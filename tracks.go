@@ -0,0 +1,406 @@
+package ghost
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/eyeson-team/gosepp/v3"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// maximum duration of a client initiated renegotiation
+const renegotiationTimeout = 10 * time.Second
+
+// ErrTrackNotFound is returned by RemoveTrack for tracks not sent.
+var ErrTrackNotFound = errors.New("ghost: track not found")
+
+// errOfferRolledBack is passed to a pending offer crossed by an offer of
+// the conference.
+var errOfferRolledBack = errors.New("ghost: offer rolled back")
+
+// localSender is a local track sent to the conference. It is added again
+// to the peer connection of a call recovery. sender, transceiver and
+// paused are guarded by the sendersMu of the client.
+type localSender struct {
+	writer            RTPWriter
+	track             webrtc.TrackLocal
+	onKeyframeRequest func()
+	sender            *webrtc.RTPSender
+	transceiver       *webrtc.RTPTransceiver
+	// paused tracks keep their transceiver without sending
+	paused bool
+}
+
+// LocalTrack is a track added during the call via AddVideoTrack or
+// AddAudioTrack.
+type LocalTrack struct {
+	track *localTrack
+
+	mu                     sync.Mutex
+	keyframeRequestHandler KeyframeRequestHandler
+}
+
+// ID returns the track id.
+func (lt *LocalTrack) ID() string {
+	return lt.track.ID()
+}
+
+// WriteRTP implements RTPWriter
+func (lt *LocalTrack) WriteRTP(p *rtp.Packet) error {
+	return lt.track.WriteRTP(p)
+}
+
+// MimeType implements CodecWriter
+func (lt *LocalTrack) MimeType() string {
+	return lt.track.MimeType()
+}
+
+// SetKeyframeRequestHandler forwards keyframe requests for this track.
+func (lt *LocalTrack) SetKeyframeRequestHandler(handler KeyframeRequestHandler) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.keyframeRequestHandler = handler
+}
+
+func (lt *LocalTrack) onKeyframeRequest() {
+	lt.mu.Lock()
+	handler := lt.keyframeRequestHandler
+	lt.mu.Unlock()
+	if handler != nil {
+		handler()
+	}
+}
+
+// AddVideoTrack adds a video track, e.g. for a second feed, and
+// renegotiates a running call. It returns after the answer of the
+// conference is applied. Track changes and mutes are negotiated one after
+// the other. The track uses one of the video codecs offered, see MimeType.
+func (cl *Client) AddVideoTrack(id string) (*LocalTrack, error) {
+	track := newLocalTrack(webrtc.RTPCodecTypeVideo, cl.videoCodecPreferences(),
+		id, id)
+	track.mimeType = cl.NegotiatedVideoCodec
+	return cl.addTrack(track)
+}
+
+// AddAudioTrack adds an opus audio track and renegotiates a running call.
+func (cl *Client) AddAudioTrack(id string) (*LocalTrack, error) {
+	track := newLocalTrack(webrtc.RTPCodecTypeAudio, []string{webrtc.MimeTypeOpus},
+		id, id)
+	track.mimeType = func() string { return webrtc.MimeTypeOpus }
+	return cl.addTrack(track)
+}
+
+func (cl *Client) addTrack(track *localTrack) (*LocalTrack, error) {
+	localTrack := &LocalTrack{track: track}
+	entry := &localSender{writer: localTrack, track: track}
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		entry.onKeyframeRequest = localTrack.onKeyframeRequest
+	}
+
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+
+	cl.sendersMu.Lock()
+	if err := cl.addSender(cl.activePeerConnection(), entry); err != nil {
+		cl.sendersMu.Unlock()
+		return nil, err
+	}
+	cl.tracksMu.Lock()
+	cl.localSenders = append(cl.localSenders, entry)
+	cl.tracksMu.Unlock()
+	cl.sendersMu.Unlock()
+
+	if err := cl.renegotiateLocked(); err != nil {
+		// the track is not handed out, so don't send it with a later offer
+		if errRemove := cl.removeLocalSender(localTrack); errRemove != nil {
+			cl.logger.Warn("Failed to remove track: %s", errRemove)
+		}
+		return nil, err
+	}
+	return localTrack, nil
+}
+
+// RemoveTrack stops sending a track and renegotiates a running call. Both
+// tracks added during the call and the tracks passed to the
+// ConnectedHandler can be removed.
+func (cl *Client) RemoveTrack(track RTPWriter) error {
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+
+	if err := cl.removeLocalSender(track); err != nil {
+		return err
+	}
+	return cl.renegotiateLocked()
+}
+
+// removeLocalSender removes the local track of writer from the peer
+// connection and the local tracks, so it isn't added to the peer
+// connection of a call recovery.
+func (cl *Client) removeLocalSender(writer RTPWriter) error {
+	cl.sendersMu.Lock()
+	defer cl.sendersMu.Unlock()
+
+	cl.tracksMu.Lock()
+	var entry *localSender
+	for i, s := range cl.localSenders {
+		if s.writer == writer {
+			entry = s
+			cl.localSenders = append(cl.localSenders[:i], cl.localSenders[i+1:]...)
+			break
+		}
+	}
+	cl.tracksMu.Unlock()
+	if entry == nil {
+		return ErrTrackNotFound
+	}
+	if entry.paused {
+		return nil
+	}
+	return cl.activePeerConnection().RemoveTrack(entry.sender)
+}
+
+// addLocalSenders adds all local tracks to a peer connection. Must be
+// called with sendersMu held.
+func (cl *Client) addLocalSenders(peerConnection *webrtc.PeerConnection) error {
+	cl.tracksMu.Lock()
+	senders := append([]*localSender{}, cl.localSenders...)
+	cl.tracksMu.Unlock()
+
+	for _, entry := range senders {
+		if err := cl.addSender(peerConnection, entry); err != nil {
+			return err
+		}
+		if entry.paused {
+			if err := peerConnection.RemoveTrack(entry.sender); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addSender sends the track of entry on a new transceiver.
+func (cl *Client) addSender(peerConnection *webrtc.PeerConnection, entry *localSender) error {
+	var sender *webrtc.RTPSender
+	if cl.sendOnly {
+		transceiver, err := peerConnection.AddTransceiverFromTrack(entry.track,
+			webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+		if err != nil {
+			return err
+		}
+		sender = transceiver.Sender()
+	} else {
+		var err error
+		if sender, err = peerConnection.AddTrack(entry.track); err != nil {
+			return err
+		}
+	}
+	for _, transceiver := range peerConnection.GetTransceivers() {
+		if transceiver.Sender() == sender {
+			entry.transceiver = transceiver
+		}
+	}
+	cl.startSender(entry, sender)
+	return nil
+}
+
+// resumeSender sends the track of entry on its paused transceiver again.
+// Unlike AddTrack this doesn't depend on the negotiated direction, so
+// no transceiver is added if the pause was not negotiated.
+func (cl *Client) resumeSender(peerConnection *webrtc.PeerConnection, api *webrtc.API,
+	entry *localSender) error {
+	sender, err := api.NewRTPSender(entry.track, peerConnection.SCTP().Transport())
+	if err != nil {
+		return err
+	}
+	if err := entry.transceiver.SetSender(sender, entry.track); err != nil {
+		sender.Stop()
+		return err
+	}
+	cl.startSender(entry, sender)
+	return nil
+}
+
+func (cl *Client) startSender(entry *localSender, sender *webrtc.RTPSender) {
+	entry.sender = sender
+	onKeyframeRequest := entry.onKeyframeRequest
+	cl.startRoutine(func() { cl.readSenderRTCP(sender, onKeyframeRequest) })
+}
+
+// pauseSender stops or resumes sending a local track. The track is
+// removed from its transceiver, which becomes recvonly or inactive, and
+// set again on resume.
+func (cl *Client) pauseSender(track webrtc.TrackLocal, paused bool) (bool, error) {
+	cl.sendersMu.Lock()
+	defer cl.sendersMu.Unlock()
+
+	cl.tracksMu.Lock()
+	var entry *localSender
+	for _, s := range cl.localSenders {
+		if s.track == track {
+			entry = s
+			break
+		}
+	}
+	cl.tracksMu.Unlock()
+	if entry == nil {
+		return false, ErrTrackNotFound
+	}
+	if entry.paused == paused {
+		return false, nil
+	}
+
+	cl.connMu.RLock()
+	peerConnection, api := cl.peerConnection, cl.api
+	cl.connMu.RUnlock()
+	var err error
+	if paused {
+		err = peerConnection.RemoveTrack(entry.sender)
+	} else {
+		err = cl.resumeSender(peerConnection, api, entry)
+	}
+	if err != nil {
+		return false, err
+	}
+	entry.paused = paused
+	return true, nil
+}
+
+// setTrackMuted pauses or resumes the sender of track and renegotiates a
+// running call. The change is undone if the renegotiation fails.
+func (cl *Client) setTrackMuted(track *localTrack, muted bool) (bool, error) {
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+
+	changed, err := cl.pauseSender(track, muted)
+	if err != nil || !changed {
+		return false, err
+	}
+	track.setMuted(muted)
+
+	if err := cl.renegotiateLocked(); err != nil {
+		if _, errUndo := cl.pauseSender(track, !muted); errUndo != nil {
+			cl.logger.Warn("Failed to undo mute: %s", errUndo)
+		}
+		track.setMuted(!muted)
+		return false, err
+	}
+	return true, nil
+}
+
+// isSending reports whether a writer handed out is still sent.
+func (cl *Client) isSending(writer RTPWriter) bool {
+	cl.tracksMu.Lock()
+	defer cl.tracksMu.Unlock()
+	for _, s := range cl.localSenders {
+		if s.writer == writer {
+			return true
+		}
+	}
+	return false
+}
+
+// renegotiate sends a new offer to the conference and waits until the
+// answer is applied. Nothing is sent if the call is not started yet.
+func (cl *Client) renegotiate() error {
+	cl.negotiationMu.Lock()
+	defer cl.negotiationMu.Unlock()
+	return cl.renegotiateLocked()
+}
+
+// renegotiateLocked is renegotiate with negotiationMu held.
+func (cl *Client) renegotiateLocked() error {
+	cl.reconnectMu.Lock()
+	started := cl.callStarted
+	cl.reconnectMu.Unlock()
+	if !started {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), renegotiationTimeout)
+	defer cancel()
+	return cl.negotiate(ctx, nil)
+}
+
+// negotiate sends an offer via the sdp-update path and waits for the
+// answer, which is applied in onSdpUpdate. If an offer of the conference
+// crosses ours, ours is rolled back and sent again after the conference
+// offer is answered. Must be called with negotiationMu held.
+func (cl *Client) negotiate(ctx context.Context, options *webrtc.OfferOptions) error {
+	for {
+		err := cl.sendOffer(ctx, options)
+		if !errors.Is(err, errOfferRolledBack) {
+			return err
+		}
+		cl.logger.Info("Offer crossed by conference offer. Sending again")
+	}
+}
+
+func (cl *Client) sendOffer(ctx context.Context, options *webrtc.OfferOptions) error {
+	answerCh := make(chan error, 1)
+	cl.answerMu.Lock()
+	cl.answerCh = answerCh
+	cl.answerMu.Unlock()
+	defer func() {
+		cl.answerMu.Lock()
+		cl.answerCh = nil
+		cl.answerMu.Unlock()
+	}()
+
+	peerConnection := cl.activePeerConnection()
+	err := func() error {
+		offer, err := cl.createOffer(ctx, options)
+		if err != nil {
+			return err
+		}
+		if err := cl.activeCall().UpdateSDP(ctx, gosepp.Sdp{SdpType: "offer", Sdp: offer}); err != nil {
+			return signalingError(ctx, "update sdp", err)
+		}
+		select {
+		case err := <-answerCh:
+			return err
+		case <-ctx.Done():
+			return &CallError{Kind: ErrSignalingFailed, Op: "wait for answer",
+				Err: contextError(ctx, ctx.Err())}
+		case <-cl.closeCh:
+			return ErrClientDestroyed
+		}
+	}()
+	if err != nil {
+		// a late answer is ignored, see onSdpUpdate
+		rollbackOffer(peerConnection)
+	}
+	return err
+}
+
+// answerApplied passes the result of applying an answer, or
+// errOfferRolledBack, to the pending offer. Returns false if no offer is
+// pending.
+func (cl *Client) answerApplied(err error) bool {
+	cl.answerMu.Lock()
+	defer cl.answerMu.Unlock()
+	if cl.answerCh == nil {
+		return false
+	}
+	cl.answerCh <- err
+	cl.answerCh = nil
+	return true
+}
+
+// rollbackOffer returns to the stable state if a local offer is pending.
+// pion doesn't support rollbacks, so the last remote description of the
+// conference is applied again as answer.
+func rollbackOffer(peerConnection *webrtc.PeerConnection) bool {
+	if peerConnection.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		return false
+	}
+	current := peerConnection.CurrentRemoteDescription()
+	if current == nil {
+		return false
+	}
+	return peerConnection.SetRemoteDescription(
+		webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: current.SDP}) == nil
+}
@@ -0,0 +1,155 @@
+package ghost
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// read buffer of the ICE-TCP mux in packets
+const iceTCPReadBufferSize = 8
+
+// transportConfig collects the ICE and transport options.
+type transportConfig struct {
+	portMin         uint16
+	portMax         uint16
+	udpMuxPort      int
+	tcpPort         int
+	nat1To1IPs      []string
+	nat1To1Type     webrtc.ICECandidateType
+	interfaceFilter func(string) bool
+	ipFilter        func(net.IP) bool
+	relayOnly       bool
+	mdnsMode        ice.MulticastDNSMode
+	mdnsModeSet     bool
+}
+
+// WithICEPortRange limits the local UDP ports used for ICE candidates.
+func WithICEPortRange(portMin, portMax uint16) ClientOption {
+	return func(h *Client) {
+		h.transport.portMin = portMin
+		h.transport.portMax = portMax
+	}
+}
+
+// WithUDPMuxPort gathers all UDP candidates on a single local port.
+// Overrides WithICEPortRange.
+func WithUDPMuxPort(port int) ClientOption {
+	return func(h *Client) {
+		h.transport.udpMuxPort = port
+	}
+}
+
+// WithICETCP additionally gathers passive ICE-TCP candidates listening on
+// port.
+func WithICETCP(port int) ClientOption {
+	return func(h *Client) {
+		h.transport.tcpPort = port
+	}
+}
+
+// WithNAT1To1IPs announces the given public IPs instead of the local
+// addresses, either as host or as srflx candidates. Required if the
+// client runs behind a static 1:1 NAT, e.g. in a Kubernetes pod.
+func WithNAT1To1IPs(ips []string, candidateType webrtc.ICECandidateType) ClientOption {
+	return func(h *Client) {
+		h.transport.nat1To1IPs = ips
+		h.transport.nat1To1Type = candidateType
+	}
+}
+
+// WithInterfaceFilter only gathers candidates of network interfaces for
+// which filter returns true.
+func WithInterfaceFilter(filter func(string) bool) ClientOption {
+	return func(h *Client) {
+		h.transport.interfaceFilter = filter
+	}
+}
+
+// WithIPFilter only gathers candidates of local IPs for which filter
+// returns true.
+func WithIPFilter(filter func(net.IP) bool) ClientOption {
+	return func(h *Client) {
+		h.transport.ipFilter = filter
+	}
+}
+
+// WithRelayOnly only uses TURN relay candidates.
+func WithRelayOnly() ClientOption {
+	return func(h *Client) {
+		h.transport.relayOnly = true
+	}
+}
+
+// WithMulticastDNSMode configures mDNS host candidates. By default mDNS
+// candidates are queried but not gathered.
+func WithMulticastDNSMode(mode ice.MulticastDNSMode) ClientOption {
+	return func(h *Client) {
+		h.transport.mdnsMode = mode
+		h.transport.mdnsModeSet = true
+	}
+}
+
+// settingEngine returns the SettingEngine for a new peer connection. The
+// UDP and TCP muxes are created once and shared by all peer connections of
+// the client.
+func (cl *Client) settingEngine() (webrtc.SettingEngine, error) {
+	s := webrtc.SettingEngine{}
+	config := cl.transport
+
+	if config.udpMuxPort > 0 {
+		if cl.udpMux == nil {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: config.udpMuxPort})
+			if err != nil {
+				return s, fmt.Errorf("ghost: listen udp mux: %w", err)
+			}
+			cl.udpMux = webrtc.NewICEUDPMux(nil, conn)
+		}
+		s.SetICEUDPMux(cl.udpMux)
+	} else if config.portMin > 0 || config.portMax > 0 {
+		if err := s.SetEphemeralUDPPortRange(config.portMin, config.portMax); err != nil {
+			return s, err
+		}
+	}
+
+	if config.tcpPort > 0 {
+		if cl.tcpMux == nil {
+			listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: config.tcpPort})
+			if err != nil {
+				return s, fmt.Errorf("ghost: listen ice-tcp: %w", err)
+			}
+			cl.tcpMux = webrtc.NewICETCPMux(nil, listener, iceTCPReadBufferSize)
+		}
+		s.SetICETCPMux(cl.tcpMux)
+		s.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6,
+		})
+	}
+
+	if len(config.nat1To1IPs) > 0 {
+		s.SetNAT1To1IPs(config.nat1To1IPs, config.nat1To1Type)
+	}
+	if config.interfaceFilter != nil {
+		s.SetInterfaceFilter(config.interfaceFilter)
+	}
+	if config.ipFilter != nil {
+		s.SetIPFilter(config.ipFilter)
+	}
+	if config.mdnsModeSet {
+		s.SetICEMulticastDNSMode(config.mdnsMode)
+	}
+	return s, nil
+}
+
+// closeTransport releases the shared muxes.
+func (cl *Client) closeTransport() {
+	if cl.udpMux != nil {
+		cl.udpMux.Close()
+	}
+	if cl.tcpMux != nil {
+		cl.tcpMux.Close()
+	}
+}
@@ -0,0 +1,193 @@
+package ghost
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/eyeson-team/gosepp/v3"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// WithTrickleICE sends the offer without waiting for ice gathering and
+// exchanges the candidates via the signaling call as they are gathered.
+// Falls back to full gathering if the signaling call or the conference
+// does not support it.
+func WithTrickleICE() ClientOption {
+	return func(h *Client) {
+		h.trickleICE = true
+	}
+}
+
+// candidateExchange trickles the ice candidates of a peer connection via
+// its signaling call. Local candidates are sent after the answer, remote
+// ones are added once the remote description is set. Candidates gathered
+// after the first gathering, e.g. on ice restart, are part of the offer.
+type candidateExchange struct {
+	peerConnection *webrtc.PeerConnection
+	call           signalingCall
+	logger         gosepp.Logger
+
+	mu       sync.Mutex
+	started  bool
+	stopped  bool
+	gathered bool
+	local    []webrtc.ICECandidateInit
+	remote   []webrtc.ICECandidateInit
+}
+
+// newCandidateExchange returns nil if trickle ice is not activated or not
+// supported by the signaling call.
+func (cl *Client) newCandidateExchange(peerConnection *webrtc.PeerConnection,
+	call signalingCall) *candidateExchange {
+	if !cl.trickleICE || !call.TrickleICE() {
+		return nil
+	}
+	exchange := &candidateExchange{
+		peerConnection: peerConnection,
+		call:           call,
+		logger:         cl.logger,
+	}
+	peerConnection.OnICECandidate(exchange.addLocal)
+	call.SetICECandidateHandler(exchange.addRemote)
+	return exchange
+}
+
+// activeCandidates returns the candidate exchange of the active peer
+// connection, nil without trickle ice.
+func (cl *Client) activeCandidates() *candidateExchange {
+	cl.connMu.RLock()
+	defer cl.connMu.RUnlock()
+	return cl.candidates
+}
+
+// tricklingICE reports whether an offer is sent without waiting for ice
+// gathering.
+func (cl *Client) tricklingICE() bool {
+	exchange := cl.activeCandidates()
+	if exchange == nil {
+		return false
+	}
+	exchange.mu.Lock()
+	defer exchange.mu.Unlock()
+	return !exchange.stopped && !exchange.gathered
+}
+
+func (e *candidateExchange) addLocal(candidate *webrtc.ICECandidate) {
+	e.mu.Lock()
+	if e.stopped || e.gathered {
+		e.mu.Unlock()
+		return
+	}
+	if candidate == nil {
+		e.gathered = true
+		e.mu.Unlock()
+		return
+	}
+	init := candidate.ToJSON()
+	if !e.started {
+		e.local = append(e.local, init)
+		e.mu.Unlock()
+		return
+	}
+	e.mu.Unlock()
+	e.send(init)
+}
+
+func (e *candidateExchange) addRemote(candidate webrtc.ICECandidateInit) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		e.remote = append(e.remote, candidate)
+		return
+	}
+	if err := e.peerConnection.AddICECandidate(candidate); err != nil {
+		e.logger.Warn("Failed to add remote ice candidate: %s", err)
+	}
+}
+
+// start is called after the answer is applied. The queued candidates are
+// sent and added, further ones are forwarded immediately.
+func (e *candidateExchange) start() {
+	e.mu.Lock()
+	e.started = true
+	local, remote := e.local, e.remote
+	e.local, e.remote = nil, nil
+	for _, candidate := range remote {
+		if err := e.peerConnection.AddICECandidate(candidate); err != nil {
+			e.logger.Warn("Failed to add remote ice candidate: %s", err)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, candidate := range local {
+		e.send(candidate)
+	}
+}
+
+// stop drops the local candidates, they are sent with a full offer.
+func (e *candidateExchange) stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
+	e.local = nil
+}
+
+func (e *candidateExchange) send(candidate webrtc.ICECandidateInit) {
+	ctx, cancel := context.WithTimeout(context.Background(), renegotiationTimeout)
+	defer cancel()
+	if err := e.call.SendICECandidate(ctx, candidate); err != nil {
+		e.logger.Warn("Failed to send ice candidate: %s", err)
+	}
+}
+
+// startTrickleICE starts the candidate exchange after the answer is
+// applied. If the conference does not announce trickle ice, an offer
+// containing all candidates is negotiated instead. Must be called with
+// negotiationMu held.
+func (cl *Client) startTrickleICE(ctx context.Context, answer string) error {
+	exchange := cl.activeCandidates()
+	if exchange == nil {
+		return nil
+	}
+	if supportsTrickleICE(answer) {
+		exchange.start()
+		return nil
+	}
+
+	cl.logger.Debug("Conference does not support trickle ice. Sending all candidates")
+	exchange.stop()
+	return cl.negotiate(ctx, nil)
+}
+
+// supportsTrickleICE reports whether a session description announces
+// trickle ice.
+func supportsTrickleICE(raw string) bool {
+	desc := &sdp.SessionDescription{}
+	if err := desc.Unmarshal([]byte(raw)); err != nil {
+		return false
+	}
+	isTrickle := func(attributes []sdp.Attribute) bool {
+		for _, attr := range attributes {
+			if attr.Key != "ice-options" {
+				continue
+			}
+			for _, option := range strings.Fields(attr.Value) {
+				if option == "trickle" {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if isTrickle(desc.Attributes) {
+		return true
+	}
+	for _, media := range desc.MediaDescriptions {
+		if isTrickle(media.Attributes) {
+			return true
+		}
+	}
+	return false
+}